@@ -0,0 +1,38 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+const (
+	DATASTORE_TYPE_POSTGRES95  = "postgres95"
+	DATASTORE_TYPE_TIMESCALEDB = "timescaledb"
+)
+
+// Typed configuration for postgres-compatible datastores
+type PostgresConfiguration struct {
+	Hostname       string `json:"hostname" validate:"required"`
+	MaxConnections int32  `json:"maxConnections" validate:"min=1"`
+	Password       string `json:"password"`
+	Port           int32  `json:"port" validate:"min=1,max=65535"`
+	Username       string `json:"username"`
+}
+
+// Typed shapes of the generic configuration for known datastore types, used to describe
+// and validate DatastoreConfiguration.Configuration based on DatastoreConfiguration.Type.
+var DatastoreConfigurationTypes = map[string]interface{}{
+	DATASTORE_TYPE_POSTGRES95:  PostgresConfiguration{},
+	DATASTORE_TYPE_TIMESCALEDB: PostgresConfiguration{},
+}
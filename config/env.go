@@ -0,0 +1,198 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	ENV_OVERRIDE_PREFIX = "DC"
+)
+
+// Override configuration fields from environment variables. Variable names are built from
+// the prefix and the path of each field in upper snake case, so that for instance
+// Infrastructure.Kafka.Hostname is overridden by DC_INFRASTRUCTURE_KAFKA_HOSTNAME. Entries
+// of generic maps are addressed the same way (DC_PERSISTENCE_RDB_CONFIGURATION_MAX_CONNECTIONS
+// sets 'maxConnections'), keeping the type of an existing entry or inferring numbers and
+// booleans for new entries. Returns the names of variables that were applied.
+func ApplyEnvironmentOverrides(target interface{}, prefix string) ([]string, error) {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return nil, errors.New("environment overrides can only be applied to a non-nil pointer")
+	}
+
+	env := make(map[string]string)
+	for _, entry := range os.Environ() {
+		if idx := strings.Index(entry, "="); idx > 0 && strings.HasPrefix(entry, prefix+"_") {
+			env[entry[:idx]] = entry[idx+1:]
+		}
+	}
+	applied := make([]string, 0)
+	err := applyEnvironment(value.Elem(), prefix, env, &applied)
+	sort.Strings(applied)
+	return applied, err
+}
+
+// Apply environment overrides to a value and any values nested within it.
+func applyEnvironment(value reflect.Value, name string, env map[string]string, applied *[]string) error {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			return applyEnvironment(value.Elem(), name, env, applied)
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			fname := name + "_" + EnvironmentName(fieldName(field))
+			fvalue := value.Field(i)
+			if override, found := env[fname]; found && isScalar(fvalue) {
+				err := setFromString(fvalue, override)
+				if err != nil {
+					return fmt.Errorf("invalid value for %s: %v", fname, err)
+				}
+				*applied = append(*applied, fname)
+				continue
+			}
+			err := applyEnvironment(fvalue, fname, env, applied)
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String || value.Type().Elem().Kind() != reflect.Interface {
+			break
+		}
+		for envname, override := range env {
+			if !strings.HasPrefix(envname, name+"_") {
+				continue
+			}
+			suffix := strings.TrimPrefix(envname, name+"_")
+
+			// Match an existing entry or create a new one with a camel case key.
+			key := camelCase(suffix)
+			var existing interface{}
+			iter := value.MapRange()
+			for iter.Next() {
+				if EnvironmentName(iter.Key().String()) == suffix {
+					key = iter.Key().String()
+					existing = iter.Value().Interface()
+				}
+			}
+			parsed, err := parseOverride(override, existing)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s: %v", envname, err)
+			}
+			if value.IsNil() {
+				value.Set(reflect.MakeMap(value.Type()))
+			}
+			value.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(&parsed).Elem())
+			*applied = append(*applied, envname)
+		}
+	}
+	return nil
+}
+
+// Indicates whether a value can be set directly from a string.
+func isScalar(value reflect.Value) bool {
+	if value.Type() == durationType {
+		return true
+	}
+	switch value.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return value.Type().Elem().Kind() != reflect.Struct
+	}
+	return false
+}
+
+// Parse an override for a generic map entry based on the type of the existing value.
+func parseOverride(override string, existing interface{}) (interface{}, error) {
+	switch existing.(type) {
+	case string:
+		return override, nil
+	case bool:
+		return strconv.ParseBool(override)
+	case float64, float32, int, int32, int64, uint32, uint64:
+		return strconv.ParseFloat(override, 64)
+	case nil:
+		var inferred interface{}
+		if err := json.Unmarshal([]byte(override), &inferred); err == nil {
+			switch inferred.(type) {
+			case float64, bool:
+				return inferred, nil
+			}
+		}
+		return override, nil
+	}
+	return nil, fmt.Errorf("unable to override value of type %T", existing)
+}
+
+// Get the name of a field, preferring its json name.
+func fieldName(field reflect.StructField) string {
+	if tag := field.Tag.Get("json"); tag != "" {
+		if jname := strings.Split(tag, ",")[0]; jname != "" && jname != "-" {
+			return jname
+		}
+	}
+	return field.Name
+}
+
+// Convert a field or key name (e.g. 'HttpPort' or 'maxConnections') into the upper snake
+// case form used in environment variable names (e.g. 'HTTP_PORT' or 'MAX_CONNECTIONS').
+func EnvironmentName(name string) string {
+	runes := []rune(name)
+	var result strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				result.WriteRune('_')
+			}
+		}
+		if r == '-' || r == '.' {
+			r = '_'
+		}
+		result.WriteRune(unicode.ToUpper(r))
+	}
+	return result.String()
+}
+
+// Convert an upper snake case name (e.g. 'MAX_CONNECTIONS') to camel case ('maxConnections').
+func camelCase(name string) string {
+	parts := strings.Split(strings.ToLower(name), "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
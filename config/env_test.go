@@ -0,0 +1,144 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvironmentName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"", ""},
+		{"hostname", "HOSTNAME"},
+		{"Hostname", "HOSTNAME"},
+		{"HttpPort", "HTTP_PORT"},
+		{"maxConnections", "MAX_CONNECTIONS"},
+		{"instanceId", "INSTANCE_ID"},
+		{"ID", "ID"},
+		{"HTTPServer", "HTTP_SERVER"},
+		{"SqlDebug", "SQL_DEBUG"},
+		{"Port2Offset", "PORT2_OFFSET"},
+		{"v2", "V2"},
+		{"sentinel-addresses", "SENTINEL_ADDRESSES"},
+		{"tls.ca", "TLS_CA"},
+		{"already_snake", "ALREADY_SNAKE"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, EnvironmentName(test.name))
+		})
+	}
+}
+
+func TestCamelCase(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"", ""},
+		{"HOSTNAME", "hostname"},
+		{"MAX_CONNECTIONS", "maxConnections"},
+		{"SSL__MODE", "sslMode"},
+		{"A_B_C", "aBC"},
+		{"PORT2_OFFSET", "port2Offset"},
+		{"TRAILING_", "trailing"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, camelCase(test.name))
+		})
+	}
+}
+
+func TestCamelCaseMatchesEnvironmentName(t *testing.T) {
+	for _, name := range []string{"hostname", "maxConnections", "sslMode", "port2Offset"} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, name, camelCase(EnvironmentName(name)))
+		})
+	}
+}
+
+func TestApplyEnvironmentOverrides(t *testing.T) {
+	type nested struct {
+		Hostname  string
+		Port      int32
+		Addresses []string
+		Timeout   time.Duration
+	}
+	type target struct {
+		Server   nested
+		Optional *nested
+		Settings map[string]interface{} `json:"settings"`
+	}
+
+	t.Setenv("TEST_SERVER_HOSTNAME", "example.com")
+	t.Setenv("TEST_SERVER_PORT", "8080")
+	t.Setenv("TEST_SERVER_ADDRESSES", "a:1, b:2")
+	t.Setenv("TEST_SERVER_TIMEOUT", "5s")
+	t.Setenv("TEST_OPTIONAL_HOSTNAME", "ignored")
+	t.Setenv("TEST_SETTINGS_MAX_CONNECTIONS", "10")
+	t.Setenv("TEST_SETTINGS_SSL_MODE", "require")
+	t.Setenv("TEST_SETTINGS_DEBUG", "true")
+	t.Setenv("OTHER_SERVER_HOSTNAME", "ignored")
+
+	cfg := &target{Settings: map[string]interface{}{"sslMode": "disable", "debug": false}}
+	applied, err := ApplyEnvironmentOverrides(cfg, "TEST")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"TEST_SERVER_ADDRESSES", "TEST_SERVER_HOSTNAME", "TEST_SERVER_PORT",
+		"TEST_SERVER_TIMEOUT", "TEST_SETTINGS_DEBUG", "TEST_SETTINGS_MAX_CONNECTIONS", "TEST_SETTINGS_SSL_MODE"}, applied)
+	assert.Equal(t, nested{Hostname: "example.com", Port: 8080, Addresses: []string{"a:1", "b:2"}, Timeout: 5 * time.Second},
+		cfg.Server)
+	assert.Nil(t, cfg.Optional)
+	assert.Equal(t, map[string]interface{}{"sslMode": "require", "debug": true, "maxConnections": float64(10)},
+		cfg.Settings)
+}
+
+func TestApplyEnvironmentOverridesInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		variable string
+		value    string
+		err      string
+	}{
+		{"invalid number", "TEST_PORT", "http", "invalid value for TEST_PORT"},
+		{"invalid duration", "TEST_TIMEOUT", "5", "invalid value for TEST_TIMEOUT"},
+		{"invalid map entry", "TEST_SETTINGS_DEBUG", "maybe", "invalid value for TEST_SETTINGS_DEBUG"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(test.variable, test.value)
+			cfg := &struct {
+				Port     int
+				Timeout  time.Duration
+				Settings map[string]interface{}
+			}{Settings: map[string]interface{}{"debug": false}}
+			_, err := ApplyEnvironmentOverrides(cfg, "TEST")
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.err)
+		})
+	}
+
+	_, err := ApplyEnvironmentOverrides(struct{}{}, "TEST")
+	assert.Error(t, err)
+}
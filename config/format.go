@@ -0,0 +1,258 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FORMAT_JSON = "json"
+	FORMAT_YAML = "yaml"
+)
+
+var yamlLinePattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// Error in parsing configuration content, with the location of the problem if known.
+type ParseError struct {
+	Format string
+	Line   int
+	Column int
+	Err    error
+}
+
+func (pe *ParseError) Error() string {
+	if pe.Line > 0 && pe.Column > 0 {
+		return fmt.Sprintf("invalid %s at line %d, column %d: %v", pe.Format, pe.Line, pe.Column, pe.Err)
+	}
+	if pe.Line > 0 {
+		return fmt.Sprintf("invalid %s at line %d: %v", pe.Format, pe.Line, pe.Err)
+	}
+	return fmt.Sprintf("invalid %s: %v", pe.Format, pe.Err)
+}
+
+func (pe *ParseError) Unwrap() error {
+	return pe.Err
+}
+
+// Detect whether configuration content is json or yaml. Content is treated as json if it
+// starts with an object or array and as yaml otherwise.
+func DetectFormat(content []byte) string {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")))
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return FORMAT_JSON
+	}
+	return FORMAT_YAML
+}
+
+// Convert json or yaml configuration content to json, so that both formats produce the
+// same structures when unmarshaled. Json content is validated and returned as-is.
+func ToJSON(content []byte) ([]byte, error) {
+	if DetectFormat(content) == FORMAT_JSON {
+		var document interface{}
+		err := json.Unmarshal(content, &document)
+		if err != nil {
+			return nil, jsonParseError(content, err)
+		}
+		return content, nil
+	}
+
+	var node yaml.Node
+	err := yaml.Unmarshal(content, &node)
+	if err != nil {
+		return nil, yamlParseError(err)
+	}
+	document, err := yamlValue(&node, make(map[*yaml.Node]bool))
+	if err != nil {
+		return nil, err
+	}
+	if document == nil {
+		document = map[string]interface{}{}
+	}
+	return json.Marshal(document)
+}
+
+// Convert a yaml node into a value that can be marshaled as json. Aliases being expanded
+// are tracked so that an anchor containing itself is reported rather than followed.
+func yamlValue(node *yaml.Node, expanding map[*yaml.Node]bool) (interface{}, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return yamlValue(node.Content[0], expanding)
+	case yaml.AliasNode:
+		if expanding[node] {
+			return nil, yamlNodeError(node, fmt.Errorf("anchor '%s' value contains itself", node.Value))
+		}
+		expanding[node] = true
+		defer delete(expanding, node)
+		return yamlValue(node.Alias, expanding)
+	case yaml.MappingNode:
+		return yamlMapping(node, expanding)
+	case yaml.SequenceNode:
+		result := make([]interface{}, 0, len(node.Content))
+		for _, entry := range node.Content {
+			value, err := yamlValue(entry, expanding)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, value)
+		}
+		return result, nil
+	}
+
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return nil, yamlNodeError(node, yamlMessage(err))
+	}
+	if number, ok := value.(float64); ok && (math.IsInf(number, 0) || math.IsNaN(number)) {
+		return nil, yamlNodeError(node, fmt.Errorf("unsupported value %s", node.Value))
+	}
+	return value, nil
+}
+
+// Convert a yaml mapping node into a map. Keys defined in the mapping take precedence over
+// keys brought in with merge keys.
+func yamlMapping(node *yaml.Node, expanding map[*yaml.Node]bool) (interface{}, error) {
+	result := make(map[string]interface{})
+	defined := make(map[string]*yaml.Node)
+	merged := make([]map[string]interface{}, 0)
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		knode, vnode := node.Content[idx], node.Content[idx+1]
+		if knode.Kind == yaml.ScalarNode && knode.Tag == "!!merge" {
+			sources := []*yaml.Node{vnode}
+			if resolved := yamlResolve(vnode); resolved.Kind == yaml.SequenceNode {
+				sources = resolved.Content
+			}
+			for _, source := range sources {
+				if yamlResolve(source).Kind != yaml.MappingNode {
+					return nil, yamlNodeError(source, errors.New("map merge requires map or sequence of maps as the value"))
+				}
+				value, err := yamlValue(source, expanding)
+				if err != nil {
+					return nil, err
+				}
+				merged = append(merged, value.(map[string]interface{}))
+			}
+			continue
+		}
+
+		key, err := yamlValue(knode, expanding)
+		if err != nil {
+			return nil, err
+		}
+		switch key.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, yamlNodeError(knode, errors.New("mapping keys must be scalar values"))
+		}
+		name := fmt.Sprint(key)
+		if previous, ok := defined[name]; ok {
+			return nil, yamlNodeError(knode, fmt.Errorf("mapping key %q already defined at line %d", name, previous.Line))
+		}
+		defined[name] = knode
+		value, err := yamlValue(vnode, expanding)
+		if err != nil {
+			return nil, err
+		}
+		result[name] = value
+	}
+
+	// Earlier merge sources take precedence over later ones.
+	for idx := len(merged) - 1; idx >= 0; idx-- {
+		for key, value := range merged[idx] {
+			if _, ok := defined[key]; !ok {
+				result[key] = value
+			}
+		}
+	}
+	return result, nil
+}
+
+// Follow aliases to the node they refer to.
+func yamlResolve(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// Build a parse error located at a yaml node.
+func yamlNodeError(node *yaml.Node, err error) error {
+	return &ParseError{Format: FORMAT_YAML, Line: node.Line, Column: node.Column, Err: err}
+}
+
+// Build a parse error with line/column information from a json error.
+func jsonParseError(content []byte, err error) error {
+	var offset int64
+	var syntax *json.SyntaxError
+	var typed *json.UnmarshalTypeError
+	if errors.As(err, &syntax) {
+		offset = syntax.Offset
+	} else if errors.As(err, &typed) {
+		offset = typed.Offset
+	} else {
+		return &ParseError{Format: FORMAT_JSON, Err: err}
+	}
+	line, column := position(content, offset)
+	return &ParseError{Format: FORMAT_JSON, Line: line, Column: column, Err: err}
+}
+
+// Build a parse error from a yaml syntax error. The yaml parser only reports the line of
+// syntax errors, so no column is available.
+func yamlParseError(err error) error {
+	message := err.Error()
+	if match := yamlLinePattern.FindStringSubmatch(message); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		return &ParseError{Format: FORMAT_YAML, Line: line, Err: errors.New(match[2])}
+	}
+	return &ParseError{Format: FORMAT_YAML, Err: errors.New(strings.TrimPrefix(message, "yaml: "))}
+}
+
+// Get the message for an error decoding a yaml node without the location prefix, since
+// the location is taken from the node.
+func yamlMessage(err error) error {
+	var typed *yaml.TypeError
+	message := err.Error()
+	if errors.As(err, &typed) && len(typed.Errors) > 0 {
+		message = typed.Errors[0]
+	}
+	if match := yamlLinePattern.FindStringSubmatch(message); match != nil {
+		message = match[2]
+	}
+	return errors.New(strings.TrimPrefix(message, "yaml: "))
+}
+
+// Compute line and column (starting at one) for an offset within content.
+func position(content []byte, offset int64) (int, int) {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	before := content[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
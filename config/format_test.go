@@ -0,0 +1,80 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"empty", "", `{}`},
+		{"comments only", "# nothing here\n", `{}`},
+		{"json", `{"a": 1}`, `{"a": 1}`},
+		{"nested yaml", "a:\n  b: [1, two, true]\n  c: null\n", `{"a":{"b":[1,"two",true],"c":null}}`},
+		{"scalar keys", "1: one\ntrue: yes\n", `{"1":"one","true":"yes"}`},
+		{"large integer", "id: 9007199254740993\n", `{"id":9007199254740993}`},
+		{"aliases", "base: &base {a: 1}\ncopy: *base\n", `{"base":{"a":1},"copy":{"a":1}}`},
+		{"merge keys", "base: &base {a: 1, b: 2}\nother: &other {b: 3, c: 4}\nderived:\n  <<: [*base, *other]\n  a: 5\n",
+			`{"base":{"a":1,"b":2},"derived":{"a":5,"b":2,"c":4},"other":{"b":3,"c":4}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content, err := ToJSON([]byte(test.content))
+			require.NoError(t, err)
+			assert.JSONEq(t, test.expected, string(content))
+		})
+	}
+}
+
+func TestToJSONErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		format  string
+		line    int
+		column  int
+		err     string
+	}{
+		{"json syntax", "{\n  \"a\": 1,\n}", FORMAT_JSON, 3, 2, "invalid character '}'"},
+		{"yaml syntax", "a: [1, 2\nb: 3\n", FORMAT_YAML, 1, 0, "did not find expected ',' or ']'"},
+		{"duplicate key", "a: 1\nb:\n  c: 2\n  c: 3\n", FORMAT_YAML, 4, 3, `mapping key "c" already defined at line 3`},
+		{"invalid tag", "a:\n  b: !!int abc\n", FORMAT_YAML, 2, 6, "cannot decode !!str `abc` as a !!int"},
+		{"complex key", "? [a, b]\n: c\n", FORMAT_YAML, 1, 3, "mapping keys must be scalar values"},
+		{"unsupported number", "a:\n  - .inf\n", FORMAT_YAML, 2, 5, "unsupported value .inf"},
+		{"invalid merge", "a:\n  <<: 1\n", FORMAT_YAML, 2, 7, "map merge requires map"},
+		{"recursive alias", "a: &a [*a]\n", FORMAT_YAML, 1, 8, "anchor 'a' value contains itself"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ToJSON([]byte(test.content))
+			require.IsType(t, &ParseError{}, err)
+			perr := err.(*ParseError)
+			assert.Equal(t, test.format, perr.Format)
+			assert.Equal(t, test.line, perr.Line)
+			assert.Equal(t, test.column, perr.Column)
+			assert.Contains(t, perr.Err.Error(), test.err)
+		})
+	}
+}
@@ -16,16 +16,60 @@
 
 package config
 
-// Redis configuration parameters
+// Redis configuration parameters. Timeouts are in milliseconds, with zero using the client
+// default and -1 disabling read, write and idle timeouts.
 type RedisConfiguration struct {
-	Hostname string
-	Port     int32
+	Hostname               string
+	Port                   int32 `validate:"min=1,max=65535"`
+	Username               string
+	Password               string
+	Database               int32 `validate:"min=0"`
+	Tls                    RedisTlsConfiguration
+	Sentinel               RedisSentinelConfiguration
+	Cluster                RedisClusterConfiguration
+	PoolSize               int32 `validate:"min=0"`
+	MinIdleConnections     int32 `validate:"min=0"`
+	DialTimeoutMillis      int32 `validate:"min=0"`
+	ReadTimeoutMillis      int32 `validate:"min=-1"`
+	WriteTimeoutMillis     int32 `validate:"min=-1"`
+	PoolTimeoutMillis      int32 `validate:"min=0"`
+	IdleTimeoutMillis      int32 `validate:"min=-1"`
+	MaxConnectionAgeMillis int32 `validate:"min=0"`
+}
+
+// Redis TLS configuration. The system root certificates are used unless a CA file is given.
+type RedisTlsConfiguration struct {
+	Enabled            bool
+	CaFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// Redis Cluster configuration. If no node addresses are given, the Redis hostname and port
+// are used to discover the cluster.
+type RedisClusterConfiguration struct {
+	Enabled        bool
+	Addresses      []string
+	MaxRedirects   int32 `validate:"min=0"`
+	ReadOnly       bool
+	RouteByLatency bool
+}
+
+// Redis Sentinel configuration. A failover client is used when a master name is set. If no
+// sentinel addresses are given, the Redis hostname and port are used.
+type RedisSentinelConfiguration struct {
+	MasterName string
+	Addresses  []string
+	Username   string
+	Password   string
 }
 
 // Kafka configuration parameters
 type KafkaConfiguration struct {
 	Hostname                      string
-	Port                          uint32
+	Port                          uint32 `validate:"min=1,max=65535"`
 	DefaultTopicPartitions        uint32
 	DefaultTopicReplicationFactor uint32
 }
@@ -33,13 +77,13 @@ type KafkaConfiguration struct {
 // Prometheus metrics configuration
 type MetricsConfiguration struct {
 	Enabled  bool
-	HttpPort int32
+	HttpPort int32 `validate:"min=1,max=65535"`
 }
 
 // Keycloak connectivity configuration
 type KeycloakConfiguration struct {
 	Hostname string
-	Port     uint32
+	Port     uint32 `validate:"min=1,max=65535"`
 }
 
 // Infrastructure configuration section
@@ -93,7 +137,7 @@ func NewDefaultInstanceConfiguration() *InstanceConfiguration {
 		},
 		Persistence: PersistenceConfiguration{
 			Rdb: DatastoreConfiguration{
-				Type: "postgres95",
+				Type: DATASTORE_TYPE_POSTGRES95,
 				Configuration: map[string]interface{}{
 					"hostname":       "dc-postgresql.dc-system",
 					"port":           5432,
@@ -103,7 +147,7 @@ func NewDefaultInstanceConfiguration() *InstanceConfiguration {
 				},
 			},
 			Tsdb: DatastoreConfiguration{
-				Type: "timescaledb",
+				Type: DATASTORE_TYPE_TIMESCALEDB,
 				Configuration: map[string]interface{}{
 					"hostname":       "dc-timescaledb-single.dc-system",
 					"port":           5432,
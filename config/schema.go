@@ -0,0 +1,501 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	SCHEMA_DRAFT       = "http://json-schema.org/draft-07/schema#"
+	SCHEMA_DEFINITIONS = "#/definitions/"
+
+	SCHEMA_TYPE_OBJECT  = "object"
+	SCHEMA_TYPE_ARRAY   = "array"
+	SCHEMA_TYPE_STRING  = "string"
+	SCHEMA_TYPE_INTEGER = "integer"
+	SCHEMA_TYPE_NUMBER  = "number"
+	SCHEMA_TYPE_BOOLEAN = "boolean"
+	SCHEMA_TYPE_NULL    = "null"
+)
+
+var datastoreConfigurationType = reflect.TypeOf(DatastoreConfiguration{})
+
+// Types allowed by a schema, marshaled as a single type name or a list of names.
+type SchemaTypes []string
+
+func (st SchemaTypes) MarshalJSON() ([]byte, error) {
+	if len(st) == 1 {
+		return json.Marshal(st[0])
+	}
+	return json.Marshal([]string(st))
+}
+
+func (st *SchemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*st = SchemaTypes{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(st))
+}
+
+// Indicates whether a type is allowed.
+func (st SchemaTypes) Has(stype string) bool {
+	for _, allowed := range st {
+		if allowed == stype {
+			return true
+		}
+	}
+	return false
+}
+
+// JSON Schema (draft-07) describing a configuration document. Only the keywords needed
+// to describe configuration structs are supported.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 SchemaTypes        `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Const                interface{}        `json:"const,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	If                   *Schema            `json:"if,omitempty"`
+	Then                 *Schema            `json:"then,omitempty"`
+	Definitions          map[string]*Schema `json:"definitions,omitempty"`
+}
+
+// Generate the schema for instance configuration. The generic configuration of each
+// datastore is described by the typed shape registered for its type in
+// DatastoreConfigurationTypes.
+func InstanceConfigurationSchema() *Schema {
+	schema := GenerateSchema(InstanceConfiguration{})
+	schema.Title = "DeviceChain instance configuration"
+	return schema
+}
+
+// Generate the schema for instance configuration as indented json.
+func InstanceConfigurationSchemaJSON() ([]byte, error) {
+	return json.MarshalIndent(InstanceConfigurationSchema(), "", "  ")
+}
+
+// Generate a schema describing the json form of a value. Properties are named as they are
+// by json marshaling and string properties also accept secret references. As with json
+// unmarshaling, null is accepted for any value. Rules from 'validate' tags are included
+// with the same exemption for zero values as Validate.
+func GenerateSchema(value interface{}) *Schema {
+	gen := &schemaGenerator{definitions: make(map[string]*Schema)}
+	schema := gen.generate(reflect.TypeOf(value))
+	schema.Schema = SCHEMA_DRAFT
+	if len(gen.definitions) > 0 {
+		schema.Definitions = gen.definitions
+	}
+	return schema
+}
+
+// Generates schemas for types, collecting shared definitions.
+type schemaGenerator struct {
+	definitions map[string]*Schema
+}
+
+// Generate the schema for a type, allowing null in place of a value.
+func (gen *schemaGenerator) generate(t reflect.Type) *Schema {
+	schema := gen.generateType(t)
+	if len(schema.Type) > 0 && !schema.Type.Has(SCHEMA_TYPE_NULL) {
+		schema.Type = append(schema.Type, SCHEMA_TYPE_NULL)
+	}
+	return schema
+}
+
+// Generate the schema for the values of a type.
+func (gen *schemaGenerator) generateType(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	if t == durationType {
+		return &Schema{Type: SchemaTypes{SCHEMA_TYPE_INTEGER}}
+	}
+	if t == datastoreConfigurationType {
+		return gen.datastore(t)
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return gen.generateType(t.Elem())
+	case reflect.String:
+		return &Schema{Type: SchemaTypes{SCHEMA_TYPE_STRING}}
+	case reflect.Bool:
+		return &Schema{Type: SchemaTypes{SCHEMA_TYPE_BOOLEAN}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: SchemaTypes{SCHEMA_TYPE_INTEGER}}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: SchemaTypes{SCHEMA_TYPE_INTEGER}, Minimum: floatPtr(0)}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: SchemaTypes{SCHEMA_TYPE_NUMBER}}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: SchemaTypes{SCHEMA_TYPE_ARRAY}, Items: gen.generate(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: SchemaTypes{SCHEMA_TYPE_OBJECT}, AdditionalProperties: gen.generate(t.Elem())}
+	case reflect.Struct:
+		return gen.object(t)
+	}
+	return &Schema{}
+}
+
+// Generate the schema for a struct.
+func (gen *schemaGenerator) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: SchemaTypes{SCHEMA_TYPE_OBJECT}, Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Tag.Get("json") == "-" {
+			continue
+		}
+		name := fieldName(field)
+		fschema := gen.generate(field.Type)
+		if rules, found := field.Tag.Lookup(TAG_VALIDATE); found {
+			for _, rule := range strings.Split(rules, ",") {
+				if strings.TrimSpace(rule) == RULE_REQUIRED {
+					schema.Required = append(schema.Required, name)
+				} else {
+					applyRule(fschema, strings.TrimSpace(rule))
+				}
+			}
+		}
+		if fschema.Type.Has(SCHEMA_TYPE_STRING) {
+			fschema = &Schema{AnyOf: []*Schema{fschema, gen.secretRef()}}
+		}
+		schema.Properties[name] = fschema
+	}
+	return schema
+}
+
+// Generate the schema for a datastore. The generic configuration is checked against the
+// typed shape registered for the datastore type (if any).
+func (gen *schemaGenerator) datastore(t reflect.Type) *Schema {
+	schema := gen.object(t)
+	tname := fieldName(fieldByName(t, "Type"))
+	cname := fieldName(fieldByName(t, "Configuration"))
+
+	types := make([]string, 0, len(DatastoreConfigurationTypes))
+	for dstype := range DatastoreConfigurationTypes {
+		types = append(types, dstype)
+	}
+	sort.Strings(types)
+	for _, dstype := range types {
+		name := "datastore." + dstype
+		if _, found := gen.definitions[name]; !found {
+			gen.definitions[name] = gen.generate(reflect.TypeOf(DatastoreConfigurationTypes[dstype]))
+		}
+		schema.AllOf = append(schema.AllOf, &Schema{
+			If: &Schema{
+				Properties: map[string]*Schema{tname: {Const: dstype}},
+				Required:   []string{tname},
+			},
+			Then: &Schema{
+				Properties: map[string]*Schema{cname: {Ref: SCHEMA_DEFINITIONS + name}},
+			},
+		})
+	}
+	return schema
+}
+
+// Get a reference to the schema of a secret reference, adding its definition if needed.
+func (gen *schemaGenerator) secretRef() *Schema {
+	if _, found := gen.definitions[SECRET_REF_KEY]; !found {
+		ref := &Schema{
+			Type: SchemaTypes{SCHEMA_TYPE_OBJECT},
+			Properties: map[string]*Schema{
+				"env":  {Type: SchemaTypes{SCHEMA_TYPE_STRING}},
+				"file": {Type: SchemaTypes{SCHEMA_TYPE_STRING}},
+			},
+			AdditionalProperties: false,
+		}
+		gen.definitions[SECRET_REF_KEY] = &Schema{
+			Type:                 SchemaTypes{SCHEMA_TYPE_OBJECT},
+			Properties:           map[string]*Schema{SECRET_REF_KEY: ref},
+			Required:             []string{SECRET_REF_KEY},
+			AdditionalProperties: false,
+		}
+	}
+	return &Schema{Ref: SCHEMA_DEFINITIONS + SECRET_REF_KEY}
+}
+
+// Apply a rule from a 'validate' tag to a schema. Validate does not check rules other than
+// 'required' against zero values, so limits are only included if the zero value (0 or an
+// empty string) satisfies them and enums always include the zero value.
+func applyRule(schema *Schema, rule string) {
+	name, arg := rule, ""
+	if idx := strings.Index(rule, "="); idx >= 0 {
+		name, arg = rule[:idx], rule[idx+1:]
+	}
+	numeric := schema.Type.Has(SCHEMA_TYPE_INTEGER) || schema.Type.Has(SCHEMA_TYPE_NUMBER)
+	str := schema.Type.Has(SCHEMA_TYPE_STRING)
+	switch name {
+	case RULE_MIN, RULE_MAX:
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil || (name == RULE_MIN && limit > 0) || (name == RULE_MAX && limit < 0) {
+			return
+		}
+		switch {
+		case numeric && name == RULE_MIN:
+			schema.Minimum = floatPtr(limit)
+		case numeric && name == RULE_MAX:
+			schema.Maximum = floatPtr(limit)
+		case str && name == RULE_MAX:
+			schema.MaxLength = intPtr(int(limit))
+		}
+	case RULE_ONEOF:
+		if numeric {
+			schema.Enum = append(schema.Enum, float64(0))
+		} else if str {
+			schema.Enum = append(schema.Enum, "")
+		}
+		for _, option := range strings.Fields(arg) {
+			if parsed, err := strconv.ParseFloat(option, 64); err == nil && numeric {
+				schema.Enum = append(schema.Enum, parsed)
+			} else {
+				schema.Enum = append(schema.Enum, option)
+			}
+		}
+		if schema.Type.Has(SCHEMA_TYPE_NULL) {
+			schema.Enum = append(schema.Enum, nil)
+		}
+	}
+}
+
+// Validate a json document against a schema and return all violations. Properties are
+// matched case-insensitively when there is no exact match, in the same way that json is
+// unmarshaled into structs.
+func ValidateJSON(schema *Schema, content []byte) error {
+	var document interface{}
+	err := json.Unmarshal(content, &document)
+	if err != nil {
+		return err
+	}
+	violations := make(ValidationErrors, 0)
+	validator := &schemaValidator{root: schema}
+	validator.validate(schema, document, "", &violations)
+	if len(violations) > 0 {
+		return violations
+	}
+	return nil
+}
+
+// Validates documents against a root schema, resolving references to its definitions.
+type schemaValidator struct {
+	root *Schema
+}
+
+// Validate a value against a schema, adding any violations.
+func (sv *schemaValidator) validate(schema *Schema, value interface{}, path string, violations *ValidationErrors) {
+	violation := func(rule string, format string, args ...interface{}) {
+		field := path
+		if field == "" {
+			field = "configuration"
+		}
+		*violations = append(*violations, &FieldError{Field: field, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if schema.Ref != "" {
+		ref, found := sv.root.Definitions[strings.TrimPrefix(schema.Ref, SCHEMA_DEFINITIONS)]
+		if !found {
+			violation("$ref", "references unknown schema '%s'", schema.Ref)
+			return
+		}
+		sv.validate(ref, value, path, violations)
+		return
+	}
+	if len(schema.Type) > 0 && !matchesType(schema.Type, value) {
+		violation("type", "must be of type %s (was %s)", strings.Join(schema.Type, " or "), typeOf(value))
+		return
+	}
+	if schema.Const != nil && !reflect.DeepEqual(schema.Const, value) {
+		violation("const", "must be '%v'", schema.Const)
+	}
+	if len(schema.Enum) > 0 {
+		matched := false
+		for _, option := range schema.Enum {
+			matched = matched || reflect.DeepEqual(option, value)
+		}
+		if !matched {
+			violation("enum", "must be one of %v (was '%v')", schema.Enum, value)
+		}
+	}
+
+	switch typed := value.(type) {
+	case float64:
+		if schema.Minimum != nil && typed < *schema.Minimum {
+			violation("minimum", "must be at least %v", *schema.Minimum)
+		}
+		if schema.Maximum != nil && typed > *schema.Maximum {
+			violation("maximum", "must be at most %v", *schema.Maximum)
+		}
+	case string:
+		length := utf8.RuneCountInString(typed)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			violation("minLength", "must have at least %d characters", *schema.MinLength)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			violation("maxLength", "must have at most %d characters", *schema.MaxLength)
+		}
+	case []interface{}:
+		if schema.Items != nil {
+			for idx, entry := range typed {
+				sv.validate(schema.Items, entry, fmt.Sprintf("%s[%d]", path, idx), violations)
+			}
+		}
+	case map[string]interface{}:
+		sv.validateObject(schema, typed, path, violations)
+	}
+
+	for _, sub := range schema.AllOf {
+		sv.validate(sub, value, path, violations)
+	}
+	if len(schema.AnyOf) > 0 {
+		matched := false
+		for _, sub := range schema.AnyOf {
+			matched = matched || sv.matches(sub, value, path)
+		}
+		if !matched {
+			violation("anyOf", "does not match any of the allowed forms")
+		}
+	}
+	if schema.If != nil && schema.Then != nil && sv.matches(schema.If, value, path) {
+		sv.validate(schema.Then, value, path, violations)
+	}
+}
+
+// Validate the properties of an object against a schema.
+func (sv *schemaValidator) validateObject(schema *Schema, value map[string]interface{}, path string, violations *ValidationErrors) {
+	for _, name := range schema.Required {
+		if _, found := lookupProperty(value, name); !found {
+			*violations = append(*violations, &FieldError{Field: joinPath(path, name), Rule: "required", Message: "is required"})
+		}
+	}
+	for key, entry := range value {
+		if property, found := lookupProperty(schema.Properties, key); found {
+			sv.validate(property.(*Schema), entry, joinPath(path, key), violations)
+			continue
+		}
+		switch additional := schema.AdditionalProperties.(type) {
+		case *Schema:
+			sv.validate(additional, entry, joinPath(path, key), violations)
+		case bool:
+			if !additional {
+				*violations = append(*violations, &FieldError{Field: joinPath(path, key),
+					Rule: "additionalProperties", Message: "is not allowed"})
+			}
+		}
+	}
+}
+
+// Indicates whether a value is valid for a schema.
+func (sv *schemaValidator) matches(schema *Schema, value interface{}, path string) bool {
+	violations := make(ValidationErrors, 0)
+	sv.validate(schema, value, path, &violations)
+	return len(violations) == 0
+}
+
+// Look up an entry by name in a map with string keys, preferring an exact match and
+// falling back to a case-insensitive match.
+func lookupProperty(properties interface{}, name string) (interface{}, bool) {
+	value := reflect.ValueOf(properties)
+	if value.Kind() != reflect.Map || value.Len() == 0 {
+		return nil, false
+	}
+	if entry := value.MapIndex(reflect.ValueOf(name)); entry.IsValid() {
+		return entry.Interface(), true
+	}
+	iter := value.MapRange()
+	for iter.Next() {
+		if strings.EqualFold(iter.Key().String(), name) {
+			return iter.Value().Interface(), true
+		}
+	}
+	return nil, false
+}
+
+// Indicates whether a generic json value matches any of the schema types.
+func matchesType(stypes SchemaTypes, value interface{}) bool {
+	for _, stype := range stypes {
+		switch stype {
+		case SCHEMA_TYPE_INTEGER:
+			if number, ok := value.(float64); ok && number == math.Trunc(number) {
+				return true
+			}
+		case SCHEMA_TYPE_NUMBER:
+			if _, ok := value.(float64); ok {
+				return true
+			}
+		default:
+			if typeOf(value) == stype {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Get the schema type of a generic json value.
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return SCHEMA_TYPE_OBJECT
+	case []interface{}:
+		return SCHEMA_TYPE_ARRAY
+	case string:
+		return SCHEMA_TYPE_STRING
+	case float64:
+		return SCHEMA_TYPE_NUMBER
+	case bool:
+		return SCHEMA_TYPE_BOOLEAN
+	case nil:
+		return SCHEMA_TYPE_NULL
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// Get a struct field by name.
+func fieldByName(t reflect.Type, name string) reflect.StructField {
+	field, _ := t.FieldByName(name)
+	return field
+}
+
+// Get a pointer to a float value.
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
+// Get a pointer to an int value.
+func intPtr(value int) *int {
+	return &value
+}
@@ -0,0 +1,128 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultInstanceConfigurationMatchesSchema(t *testing.T) {
+	content, err := json.Marshal(NewDefaultInstanceConfiguration())
+	require.NoError(t, err)
+	assert.NoError(t, ValidateJSON(InstanceConfigurationSchema(), content))
+
+	content, err = json.Marshal(&InstanceConfiguration{})
+	require.NoError(t, err)
+	assert.NoError(t, ValidateJSON(InstanceConfigurationSchema(), content))
+}
+
+func TestYamlInstanceConfigurationMatchesSchema(t *testing.T) {
+	content, err := ToJSON([]byte("Infrastructure:\n  Redis:\n    Sentinel:\n      Addresses:\n    Port: 0\nPersistence:\n  Rdb:\n"))
+	require.NoError(t, err)
+	assert.NoError(t, ValidateJSON(InstanceConfigurationSchema(), content))
+}
+
+func TestValidateInstanceConfiguration(t *testing.T) {
+	tests := []struct {
+		name       string
+		document   string
+		violations []string
+	}{
+		{"empty", `{}`, nil},
+		{"null", `null`, nil},
+		{"null values", `{"Infrastructure":{"Redis":{"Cluster":{"Addresses":null},"Port":null}},"Persistence":{"Rdb":{"Configuration":null}}}`, nil},
+		{"zero port", `{"Infrastructure":{"Kafka":{"Port":0}}}`, nil},
+		{"case insensitive", `{"infrastructure":{"kafka":{"port":9092}}}`, nil},
+		{"secret on any string", `{"Persistence":{"Rdb":{"Type":"postgres95","Configuration":{"hostname":"h","username":{"secretRef":{"env":"PG_USER"}}}}}}`, nil},
+		{"secret on nested string", `{"Infrastructure":{"Redis":{"Username":{"secretRef":{"file":"/secrets/user"}}}}}`, nil},
+		{"unknown datastore type", `{"Persistence":{"Rdb":{"Type":"mysql","Configuration":{"port":"x"}}}}`, nil},
+		{"wrong type", `{"Infrastructure":{"Kafka":{"Port":"x"}}}`,
+			[]string{"Infrastructure.Kafka.Port"}},
+		{"fraction for integer", `{"Infrastructure":{"Kafka":{"Port":1.5}}}`,
+			[]string{"Infrastructure.Kafka.Port"}},
+		{"port too large", `{"Infrastructure":{"Redis":{"Port":70000}}}`,
+			[]string{"Infrastructure.Redis.Port"}},
+		{"negative unsigned", `{"Infrastructure":{"Kafka":{"DefaultTopicPartitions":-1}}}`,
+			[]string{"Infrastructure.Kafka.DefaultTopicPartitions"}},
+		{"typed datastore", `{"Persistence":{"Tsdb":{"Type":"timescaledb","Configuration":{"port":"5432"}}}}`,
+			[]string{"Persistence.Tsdb.Configuration.hostname", "Persistence.Tsdb.Configuration.port"}},
+		{"invalid secret", `{"Infrastructure":{"Redis":{"Password":{"secretRef":{"vault":"x"}}}}}`,
+			[]string{"Infrastructure.Redis.Password"}},
+		{"not an object", `[]`, []string{"configuration"}},
+	}
+	schema := InstanceConfigurationSchema()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateJSON(schema, []byte(test.document))
+			if test.violations == nil {
+				assert.NoError(t, err)
+				return
+			}
+			require.IsType(t, ValidationErrors{}, err)
+			fields := make([]string, 0)
+			for _, violation := range err.(ValidationErrors) {
+				fields = append(fields, violation.Field)
+			}
+			assert.ElementsMatch(t, test.violations, fields)
+		})
+	}
+}
+
+func TestApplyRuleMatchesValidate(t *testing.T) {
+	type rules struct {
+		Port  int32  `validate:"min=1,max=65535"`
+		Level string `validate:"oneof=debug info"`
+		Count int32  `validate:"min=-5,max=5"`
+	}
+	schema := GenerateSchema(rules{})
+	tests := []struct {
+		document string
+		valid    bool
+	}{
+		{`{"Port":0,"Level":"","Count":0}`, true},
+		{`{"Port":1,"Level":"info","Count":-5}`, true},
+		{`{"Port":65536}`, false},
+		{`{"Level":"trace"}`, false},
+		{`{"Count":6}`, false},
+		{`{"Count":-6}`, false},
+	}
+	for _, test := range tests {
+		target := &rules{}
+		require.NoError(t, json.Unmarshal([]byte(test.document), target))
+		assert.Equal(t, test.valid, ValidateJSON(schema, []byte(test.document)) == nil, test.document)
+		assert.Equal(t, test.valid, Validate(target) == nil, test.document)
+	}
+}
+
+func TestSchemaTypesMarshaling(t *testing.T) {
+	single, err := json.Marshal(SchemaTypes{SCHEMA_TYPE_STRING})
+	require.NoError(t, err)
+	assert.Equal(t, `"string"`, string(single))
+	multiple, err := json.Marshal(SchemaTypes{SCHEMA_TYPE_STRING, SCHEMA_TYPE_NULL})
+	require.NoError(t, err)
+	assert.Equal(t, `["string","null"]`, string(multiple))
+
+	var parsed SchemaTypes
+	require.NoError(t, json.Unmarshal(single, &parsed))
+	assert.Equal(t, SchemaTypes{SCHEMA_TYPE_STRING}, parsed)
+	require.NoError(t, json.Unmarshal(multiple, &parsed))
+	assert.Equal(t, SchemaTypes{SCHEMA_TYPE_STRING, SCHEMA_TYPE_NULL}, parsed)
+}
@@ -0,0 +1,217 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	SECRET_REF_KEY = "secretRef"
+	REDACTED       = "******"
+)
+
+// Keys (matched case-insensitively as substrings) whose values are always redacted.
+var SensitiveKeys = []string{"password", "secret", "token", "credential", "apikey", "privatekey"}
+
+// Reference to a secret value held outside of the configuration. A configuration value
+// of the form {"secretRef": {"env": "PG_PASSWORD"}} or {"secretRef": {"file": "/path"}}
+// is replaced by the content of the environment variable or file when it is loaded.
+type SecretRef struct {
+	Env  string `json:"env,omitempty"`
+	File string `json:"file,omitempty"`
+}
+
+// Resolve the value referenced by a secret.
+func (ref *SecretRef) Resolve() (string, error) {
+	if ref.Env != "" && ref.File != "" {
+		return "", fmt.Errorf("secret reference may not specify both env (%s) and file (%s)", ref.Env, ref.File)
+	}
+	if ref.Env != "" {
+		value, found := os.LookupEnv(ref.Env)
+		if !found {
+			return "", fmt.Errorf("environment variable %s is not set", ref.Env)
+		}
+		return value, nil
+	}
+	if ref.File != "" {
+		content, err := os.ReadFile(ref.File)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+	return "", fmt.Errorf("secret reference must specify env or file")
+}
+
+// Resolve secret references in a json document. Returns the document with references
+// replaced by their values along with the list of secret values that were resolved (so
+// that they can be redacted). If the document has no references, it is returned as-is.
+func ResolveSecretsJSON(content []byte) ([]byte, []string, error) {
+	document, err := decodeJSON(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	secrets := make([]string, 0)
+	resolved, err := resolveSecrets(document, "", &secrets)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(secrets) == 0 {
+		return content, secrets, nil
+	}
+	content, err = json.Marshal(resolved)
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, secrets, nil
+}
+
+// Decode a json document into generic values. Numbers are kept as json.Number so that
+// large integers are not rounded when the document is marshaled again.
+func decodeJSON(content []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var document interface{}
+	err := decoder.Decode(&document)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected content after json document")
+	}
+	return document, nil
+}
+
+// Resolve secret references within a generic document.
+func resolveSecrets(document interface{}, path string, secrets *[]string) (interface{}, error) {
+	switch value := document.(type) {
+	case map[string]interface{}:
+		if refvalue, found := value[SECRET_REF_KEY]; found && len(value) == 1 {
+			ref, err := asSecretRef(refvalue)
+			if err == nil {
+				var secret string
+				secret, err = ref.Resolve()
+				if err == nil {
+					*secrets = append(*secrets, secret)
+					return secret, nil
+				}
+			}
+			return nil, fmt.Errorf("unable to resolve secret for '%s': %v", path, err)
+		}
+		for key, entry := range value {
+			resolved, err := resolveSecrets(entry, joinPath(path, key), secrets)
+			if err != nil {
+				return nil, err
+			}
+			value[key] = resolved
+		}
+	case []interface{}:
+		for idx, entry := range value {
+			resolved, err := resolveSecrets(entry, fmt.Sprintf("%s[%d]", path, idx), secrets)
+			if err != nil {
+				return nil, err
+			}
+			value[idx] = resolved
+		}
+	}
+	return document, nil
+}
+
+// Convert the content of a secret reference to its typed form.
+func asSecretRef(value interface{}) (*SecretRef, error) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	ref := &SecretRef{}
+	err = json.Unmarshal(bytes, ref)
+	if err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+// Indicates whether values for a key should always be redacted.
+func IsSensitiveKey(key string) bool {
+	lower := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+	for _, sensitive := range SensitiveKeys {
+		if strings.Contains(lower, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact a json document for logging. Values of sensitive keys and any values matching
+// known secrets are replaced. Content that is not valid json is redacted entirely.
+func RedactJSON(content []byte, secrets []string) []byte {
+	document, err := decodeJSON(content)
+	if err != nil {
+		return []byte(REDACTED)
+	}
+	redacted, err := json.Marshal(Redact(document, secrets))
+	if err != nil {
+		return []byte(REDACTED)
+	}
+	return redacted
+}
+
+// Redact a generic document (as produced by unmarshaling json) for logging. Values of
+// sensitive keys and any values matching known secrets are replaced. The original
+// document is not modified.
+func Redact(document interface{}, secrets []string) interface{} {
+	switch value := document.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{})
+		for key, entry := range value {
+			if IsSensitiveKey(key) && entry != nil {
+				result[key] = REDACTED
+			} else {
+				result[key] = Redact(entry, secrets)
+			}
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for idx, entry := range value {
+			result[idx] = Redact(entry, secrets)
+		}
+		return result
+	case string:
+		for _, secret := range secrets {
+			if secret != "" && value == secret {
+				return REDACTED
+			}
+		}
+	}
+	return document
+}
+
+// Join a key to a path within a document.
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
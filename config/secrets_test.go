@@ -0,0 +1,106 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveSecretsJSON(t *testing.T) {
+	t.Setenv("TEST_PG_PASSWORD", "s3cret")
+	file := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(file, []byte("t0ken\n"), 0600))
+
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+		secrets  []string
+	}{
+		{"no references", `{"port": 5432, "id": 12345678901234567890}`, `{"port": 5432, "id": 12345678901234567890}`, []string{}},
+		{"env reference", `{"rdb": {"password": {"secretRef": {"env": "TEST_PG_PASSWORD"}}}}`,
+			`{"rdb":{"password":"s3cret"}}`, []string{"s3cret"}},
+		{"file reference", `{"tokens": [{"secretRef": {"file": "` + file + `"}}]}`,
+			`{"tokens":["t0ken"]}`, []string{"t0ken"}},
+		{"large integer", `{"id": 9007199254740993, "ratio": 0.1, "password": {"secretRef": {"env": "TEST_PG_PASSWORD"}}}`,
+			`{"id":9007199254740993,"password":"s3cret","ratio":0.1}`, []string{"s3cret"}},
+		{"secretRef with other keys", `{"value": {"secretRef": {"env": "TEST_PG_PASSWORD"}, "other": 1}}`,
+			`{"value": {"secretRef": {"env": "TEST_PG_PASSWORD"}, "other": 1}}`, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content, secrets, err := ResolveSecretsJSON([]byte(test.content))
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(content))
+			assert.Equal(t, test.secrets, secrets)
+		})
+	}
+}
+
+func TestResolveSecretsJSONInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"invalid json", `{"a": `, "unexpected EOF"},
+		{"trailing content", `{"a": 1} {"b": 2}`, "unexpected content after json document"},
+		{"missing variable", `{"a": {"b": {"secretRef": {"env": "TEST_MISSING_SECRET"}}}}`,
+			"unable to resolve secret for 'a.b': environment variable TEST_MISSING_SECRET is not set"},
+		{"env and file", `{"a": [{"secretRef": {"env": "A", "file": "/b"}}]}`,
+			"unable to resolve secret for 'a[0]': secret reference may not specify both env (A) and file (/b)"},
+		{"empty reference", `{"a": {"secretRef": {}}}`, "secret reference must specify env or file"},
+		{"invalid reference", `{"a": {"secretRef": "PG_PASSWORD"}}`, "unable to resolve secret for 'a'"},
+		{"missing file", `{"a": {"secretRef": {"file": "/nonexistent/secret"}}}`, "unable to resolve secret for 'a'"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := ResolveSecretsJSON([]byte(test.content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.err)
+		})
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		secrets  []string
+		expected string
+	}{
+		{"sensitive keys", `{"password": "a", "Api_Key": "b", "clientSecret": {"x": 1}, "hostname": "c"}`, nil,
+			`{"Api_Key":"******","clientSecret":"******","hostname":"c","password":"******"}`},
+		{"null sensitive value", `{"password": null}`, nil, `{"password":null}`},
+		{"secret values", `{"url": "s3cret", "list": ["s3cret", "other"]}`, []string{"s3cret"},
+			`{"list":["******","other"],"url":"******"}`},
+		{"empty secret", `{"url": ""}`, []string{""}, `{"url":""}`},
+		{"large integer", `{"id": 12345678901234567890, "small": 1e3}`, nil, `{"id":12345678901234567890,"small":1e3}`},
+		{"invalid json", `{"password": "a"`, nil, REDACTED},
+		{"trailing content", `{"a": 1} "password"`, nil, REDACTED},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, string(RedactJSON([]byte(test.content), test.secrets)))
+		})
+	}
+}
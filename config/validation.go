@@ -0,0 +1,297 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TAG_DEFAULT  = "default"
+	TAG_VALIDATE = "validate"
+
+	RULE_REQUIRED = "required"
+	RULE_MIN      = "min"
+	RULE_MAX      = "max"
+	RULE_ONEOF    = "oneof"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Violation of a validation rule by a configuration field.
+type FieldError struct {
+	Field   string
+	Rule    string
+	Message string
+}
+
+func (fe *FieldError) Error() string {
+	return fmt.Sprintf("%s %s", fe.Field, fe.Message)
+}
+
+// All violations found while validating a configuration.
+type ValidationErrors []*FieldError
+
+func (ve ValidationErrors) Error() string {
+	messages := make([]string, 0, len(ve))
+	for _, fe := range ve {
+		messages = append(messages, fe.Error())
+	}
+	return fmt.Sprintf("%d violation(s): %s", len(ve), strings.Join(messages, "; "))
+}
+
+// Set fields that have a zero value to the value declared in their 'default' tag. Nested
+// structs (and non-nil pointers to structs) are processed recursively. Supported field types
+// are strings, bools, numbers, durations (e.g. "30s") and slices of those (comma-separated).
+func ApplyDefaults(target interface{}) error {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return errors.New("defaults can only be applied to a non-nil pointer")
+	}
+	return applyDefaults(value.Elem(), "")
+}
+
+// Apply defaults to a value and any values nested within it.
+func applyDefaults(value reflect.Value, path string) error {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			return applyDefaults(value.Elem(), path)
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			fvalue := value.Field(i)
+			fpath := fieldPath(path, field)
+			if def, found := field.Tag.Lookup(TAG_DEFAULT); found && fvalue.IsZero() {
+				err := setFromString(fvalue, def)
+				if err != nil {
+					return fmt.Errorf("invalid default for %s: %v", fpath, err)
+				}
+			}
+			err := applyDefaults(fvalue, fpath)
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			err := applyDefaults(value.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Set a value by parsing a string based on the value type.
+func setFromString(value reflect.Value, str string) error {
+	if value.Type() == durationType {
+		duration, err := time.ParseDuration(str)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(duration))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(str)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(str, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(str, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(str, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(parsed)
+	case reflect.Slice:
+		parts := strings.Split(str, ",")
+		slice := reflect.MakeSlice(value.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			err := setFromString(slice.Index(i), strings.TrimSpace(part))
+			if err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type().String())
+	}
+	return nil
+}
+
+// Validate fields against the rules declared in their 'validate' tag and return all
+// violations. Rules are comma-separated and include:
+//
+//	required     value must not be the zero value
+//	min=N        minimum value for numbers (or minimum length for strings, slices and maps)
+//	max=N        maximum value for numbers (or maximum length for strings, slices and maps)
+//	oneof=a b c  value must be one of the space-separated options
+//
+// Rules other than 'required' are not checked for fields with a zero value. Nested structs,
+// pointers, slices and maps are validated recursively.
+func Validate(target interface{}) error {
+	violations := make(ValidationErrors, 0)
+	validate(reflect.ValueOf(target), "", &violations)
+	if len(violations) > 0 {
+		return violations
+	}
+	return nil
+}
+
+// Validate a value and any values nested within it.
+func validate(value reflect.Value, path string, violations *ValidationErrors) {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !value.IsNil() {
+			validate(value.Elem(), path, violations)
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			fvalue := value.Field(i)
+			fpath := fieldPath(path, field)
+			if rules, found := field.Tag.Lookup(TAG_VALIDATE); found {
+				for _, rule := range strings.Split(rules, ",") {
+					if fe := checkRule(fvalue, fpath, strings.TrimSpace(rule)); fe != nil {
+						*violations = append(*violations, fe)
+					}
+				}
+			}
+			validate(fvalue, fpath, violations)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			validate(value.Index(i), fmt.Sprintf("%s[%d]", path, i), violations)
+		}
+	case reflect.Map:
+		iter := value.MapRange()
+		for iter.Next() {
+			validate(iter.Value(), fmt.Sprintf("%s[%v]", path, iter.Key().Interface()), violations)
+		}
+	}
+}
+
+// Check a single rule against a field value.
+func checkRule(value reflect.Value, path string, rule string) *FieldError {
+	if rule == "" {
+		return nil
+	}
+	name, arg := rule, ""
+	if idx := strings.Index(rule, "="); idx >= 0 {
+		name, arg = rule[:idx], rule[idx+1:]
+	}
+
+	if name == RULE_REQUIRED {
+		if value.IsZero() {
+			return &FieldError{Field: path, Rule: name, Message: "is required"}
+		}
+		return nil
+	}
+	if value.IsZero() {
+		return nil
+	}
+
+	switch name {
+	case RULE_MIN, RULE_MAX:
+		actual, limit, err := compareValues(value, arg)
+		if err != nil {
+			return &FieldError{Field: path, Rule: name, Message: fmt.Sprintf("has invalid rule '%s': %v", rule, err)}
+		}
+		if name == RULE_MIN && actual < limit {
+			return &FieldError{Field: path, Rule: name, Message: fmt.Sprintf("must be at least %s", arg)}
+		}
+		if name == RULE_MAX && actual > limit {
+			return &FieldError{Field: path, Rule: name, Message: fmt.Sprintf("must be at most %s", arg)}
+		}
+	case RULE_ONEOF:
+		actual := fmt.Sprint(value.Interface())
+		options := strings.Fields(arg)
+		for _, option := range options {
+			if actual == option {
+				return nil
+			}
+		}
+		return &FieldError{Field: path, Rule: name,
+			Message: fmt.Sprintf("must be one of [%s] (was '%s')", strings.Join(options, ", "), actual)}
+	default:
+		return &FieldError{Field: path, Rule: name, Message: fmt.Sprintf("has unknown rule '%s'", name)}
+	}
+	return nil
+}
+
+// Get the value (or length) of a field along with the parsed limit for comparison.
+func compareValues(value reflect.Value, limit string) (float64, float64, error) {
+	if value.Type() == durationType {
+		parsed, err := time.ParseDuration(limit)
+		return float64(value.Int()), float64(parsed), err
+	}
+	parsed, err := strconv.ParseFloat(limit, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), parsed, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), parsed, nil
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), parsed, nil
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return float64(value.Len()), parsed, nil
+	}
+	return 0, 0, fmt.Errorf("unsupported type %s", value.Type().String())
+}
+
+// Build the path of a field for reporting, preferring its json name.
+func fieldPath(parent string, field reflect.StructField) string {
+	name := fieldName(field)
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
@@ -0,0 +1,293 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/devicechain-io/dc-microservice/config"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DEFAULT_CONFIG_POLL_INTERVAL = 10 * time.Second
+)
+
+// Function invoked when instance configuration changes.
+type InstanceConfigurationHandler func(previous config.InstanceConfiguration, updated config.InstanceConfiguration)
+
+// Function invoked when microservice configuration changes.
+type MicroserviceConfigurationHandler func(previous []byte, updated []byte)
+
+// Register a handler invoked when a reload changes the instance configuration.
+func (ms *Microservice) AddInstanceConfigurationHandler(handler InstanceConfigurationHandler) {
+	ms.configuration.Lock()
+	defer ms.configuration.Unlock()
+	ms.instanceHandlers = append(ms.instanceHandlers, handler)
+}
+
+// Register a handler invoked when a reload changes the microservice configuration.
+func (ms *Microservice) AddMicroserviceConfigurationHandler(handler MicroserviceConfigurationHandler) {
+	ms.configuration.Lock()
+	defer ms.configuration.Unlock()
+	ms.microserviceHandlers = append(ms.microserviceHandlers, handler)
+}
+
+// Get the current instance configuration. Safe to call while configuration is reloaded.
+func (ms *Microservice) GetInstanceConfiguration() config.InstanceConfiguration {
+	ms.configuration.RLock()
+	defer ms.configuration.RUnlock()
+	return ms.InstanceConfiguration
+}
+
+// Get the current raw microservice configuration. Safe to call while configuration is reloaded.
+func (ms *Microservice) GetMicroserviceConfigurationRaw() []byte {
+	ms.configuration.RLock()
+	defer ms.configuration.RUnlock()
+	return ms.MicroserviceConfigurationRaw
+}
+
+// Apply instance configuration and notify handlers if it changed from a previous load.
+func (ms *Microservice) applyInstanceConfiguration(updated config.InstanceConfiguration) {
+	ms.configuration.Lock()
+	previous := ms.InstanceConfiguration
+	loaded := ms.instanceLoaded
+	ms.InstanceConfiguration = updated
+	ms.instanceLoaded = true
+	handlers := append([]InstanceConfigurationHandler{}, ms.instanceHandlers...)
+	ms.configuration.Unlock()
+
+	if !loaded || reflect.DeepEqual(previous, updated) {
+		return
+	}
+	log.Info().Msg("Instance configuration changed. Notifying handlers.")
+	for _, handler := range handlers {
+		handler(previous, updated)
+	}
+}
+
+// Get the current decoded microservice configuration for the struct bound with
+// BindMicroserviceConfiguration (nil if none is bound). This is the bound struct after the
+// initial load. Reloads that change the configuration decode into a new instance of the
+// same type, which is returned from then on. Returned values are never modified, so they
+// can be read without locking.
+func (ms *Microservice) GetMicroserviceConfiguration() interface{} {
+	ms.configuration.RLock()
+	defer ms.configuration.RUnlock()
+	return ms.configurationCurrent
+}
+
+// Apply microservice configuration and notify handlers if it changed from a previous load.
+// If a struct is bound to microservice configuration, the initial configuration is decoded
+// into it. Later changes are decoded into a new instance (see GetMicroserviceConfiguration)
+// before handlers are notified. If configuration can not be decoded, the current
+// configuration is kept.
+func (ms *Microservice) applyMicroserviceConfiguration(updated []byte) error {
+	ms.configuration.RLock()
+	target := ms.configurationTarget
+	loaded := ms.microserviceLoaded
+	changed := !loaded || !bytes.Equal(ms.MicroserviceConfigurationRaw, updated)
+	ms.configuration.RUnlock()
+
+	var decoded interface{}
+	if target != nil && changed {
+		decoded = target
+		if loaded {
+			decoded = reflect.New(reflect.TypeOf(target).Elem()).Interface()
+		}
+		err := decodeMicroserviceConfiguration(updated, decoded)
+		if err != nil {
+			return err
+		}
+	}
+
+	ms.configuration.Lock()
+	previous := ms.MicroserviceConfigurationRaw
+	loaded = ms.microserviceLoaded
+	ms.MicroserviceConfigurationRaw = updated
+	ms.microserviceLoaded = true
+	if decoded != nil && ms.configurationTarget == target {
+		ms.configurationCurrent = decoded
+	}
+	handlers := append([]MicroserviceConfigurationHandler{}, ms.microserviceHandlers...)
+	ms.configuration.Unlock()
+
+	if !loaded || bytes.Equal(previous, updated) {
+		return nil
+	}
+	log.Info().Msg("Microservice configuration changed. Notifying handlers.")
+	for _, handler := range handlers {
+		handler(previous, updated)
+	}
+	return nil
+}
+
+// Watches configuration files and reloads them when their content changes. Files are
+// polled and compared by content hash rather than relying on filesystem events, so updates
+// made by Kubernetes swapping the symlinks of a configmap volume are detected.
+type ConfigurationWatcher struct {
+	Microservice *Microservice
+	Interval     time.Duration
+
+	hashes    map[string][sha256.Size]byte
+	stop      chan struct{}
+	done      chan struct{}
+	lifecycle *LifecycleManager
+}
+
+// Create a new configuration watcher.
+func NewConfigurationWatcher(ms *Microservice) *ConfigurationWatcher {
+	cw := &ConfigurationWatcher{
+		Microservice: ms,
+		Interval:     DEFAULT_CONFIG_POLL_INTERVAL,
+	}
+	if interval := durationFromEnv(ENV_CONFIG_POLL_INTERVAL); interval > 0 {
+		cw.Interval = interval
+	}
+
+	// Create lifecycle manager.
+	cwname := fmt.Sprintf("%s-%s", ms.FunctionalArea, "config")
+	cw.lifecycle = NewLifecycleManager(cwname, cw, NewNoOpLifecycleCallbacks())
+	return cw
+}
+
+// Get paths of files to watch.
+func (cw *ConfigurationWatcher) files() []string {
+	files := []string{cw.Microservice.InstanceConfigurationPath()}
+	path, err := cw.Microservice.MicroserviceConfigurationPath()
+	if err == nil {
+		files = append(files, path)
+	}
+	return files
+}
+
+// Check watched files and reload configuration if any changed since the last check. Files
+// that can not be read (for instance, while a configmap update is in progress) are skipped
+// until the next check. If the reload fails, the previous configuration remains in effect.
+func (cw *ConfigurationWatcher) check() {
+	changed := false
+	for _, path := range cw.files() {
+		content, err := os.ReadFile(path)
+		if err != nil && cw.Microservice.DevMode && os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("Unable to read configuration file.")
+			continue
+		}
+		hash := sha256.Sum256(content)
+		previous, found := cw.hashes[path]
+		cw.hashes[path] = hash
+		if !found || previous != hash {
+			log.Info().Str("path", path).Msg("Detected configuration file change.")
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	err := cw.Microservice.ReloadConfiguration()
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to reload configuration. Keeping previous configuration.")
+	}
+}
+
+// Poll watched files until stopped.
+func (cw *ConfigurationWatcher) watch(stop chan struct{}, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(cw.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			cw.check()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Get lifecycle manager for component.
+func (cw *ConfigurationWatcher) Lifecycle() *LifecycleManager {
+	return cw.lifecycle
+}
+
+// Initialize component.
+func (cw *ConfigurationWatcher) Initialize(ctx context.Context) error {
+	return cw.lifecycle.Initialize(ctx)
+}
+
+// Lifecycle callback that runs initialization logic.
+func (cw *ConfigurationWatcher) ExecuteInitialize(context.Context) error {
+	return nil
+}
+
+// Start component.
+func (cw *ConfigurationWatcher) Start(ctx context.Context) error {
+	return cw.lifecycle.Start(ctx)
+}
+
+// Lifecycle callback that runs startup logic.
+func (cw *ConfigurationWatcher) ExecuteStart(context.Context) error {
+	// Record current content so that only later changes trigger a reload.
+	cw.hashes = make(map[string][sha256.Size]byte)
+	for _, path := range cw.files() {
+		content, err := os.ReadFile(path)
+		if err == nil {
+			cw.hashes[path] = sha256.Sum256(content)
+		}
+	}
+
+	cw.stop = make(chan struct{})
+	cw.done = make(chan struct{})
+	go cw.watch(cw.stop, cw.done)
+	log.Info().Dur("interval", cw.Interval).Msg("Watching configuration files for changes.")
+	return nil
+}
+
+// Stop component.
+func (cw *ConfigurationWatcher) Stop(ctx context.Context) error {
+	return cw.lifecycle.Stop(ctx)
+}
+
+// Lifecycle callback that runs shutdown logic.
+func (cw *ConfigurationWatcher) ExecuteStop(ctx context.Context) error {
+	close(cw.stop)
+	select {
+	case <-cw.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Terminate component.
+func (cw *ConfigurationWatcher) Terminate(ctx context.Context) error {
+	return cw.lifecycle.Terminate(ctx)
+}
+
+// Lifecycle callback that runs termination logic.
+func (cw *ConfigurationWatcher) ExecuteTerminate(context.Context) error {
+	return nil
+}
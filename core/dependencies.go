@@ -0,0 +1,158 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Error caused by child components whose dependencies can not be resolved.
+type DependencyError struct {
+	Component string
+	Err       error
+}
+
+func (derr *DependencyError) Error() string {
+	return derr.Err.Error()
+}
+
+func (derr *DependencyError) Unwrap() error {
+	return derr.Err
+}
+
+// Indicates whether an error was caused by unresolvable dependencies. Children are not
+// rolled back in that case since none of them were processed.
+func isDependencyError(err error) bool {
+	var derr *DependencyError
+	return errors.As(err, &derr)
+}
+
+// Verify that a child can be registered with the given dependencies. Expects the caller
+// to hold the manager lock.
+func (mgr *LifecycleManager) checkDependencies(child LifecycleComponent, dependencies []LifecycleComponent) error {
+	if _, found := mgr.dependencies[child]; found {
+		return &DependencyError{Component: mgr.Name,
+			Err: fmt.Errorf("component '%s' is already registered with '%s'", child.Lifecycle().Name, mgr.Name)}
+	}
+	for _, dep := range dependencies {
+		if dep == child {
+			return &DependencyError{Component: mgr.Name,
+				Err: fmt.Errorf("component '%s' can not depend on itself", child.Lifecycle().Name)}
+		}
+		if _, found := mgr.dependencies[dep]; !found {
+			return &DependencyError{Component: mgr.Name,
+				Err: fmt.Errorf("component '%s' depends on '%s' which is not registered with '%s'",
+					child.Lifecycle().Name, dep.Lifecycle().Name, mgr.Name)}
+		}
+	}
+	return nil
+}
+
+// Compute groups of child components in dependency order. Every component in a group
+// depends only on components in earlier groups, so members of a group may be processed
+// concurrently. Order within a group follows registration order.
+func (mgr *LifecycleManager) dependencyLayers() ([][]LifecycleComponent, error) {
+	mgr.mutex.RLock()
+	defer mgr.mutex.RUnlock()
+
+	registered := make(map[LifecycleComponent]bool)
+	for _, child := range mgr.children {
+		registered[child] = true
+	}
+
+	// Count unresolved dependencies and verify they are siblings.
+	pending := make(map[LifecycleComponent]int)
+	dependents := make(map[LifecycleComponent][]LifecycleComponent)
+	for _, child := range mgr.children {
+		pending[child] = 0
+		for _, dep := range mgr.dependencies[child] {
+			if !registered[dep] {
+				return nil, &DependencyError{Component: mgr.Name,
+					Err: fmt.Errorf("component '%s' depends on '%s' which is not registered with '%s'",
+						child.Lifecycle().Name, dep.Lifecycle().Name, mgr.Name)}
+			}
+			pending[child]++
+			dependents[dep] = append(dependents[dep], child)
+		}
+	}
+
+	// Peel off components with no unresolved dependencies until none remain.
+	layers := make([][]LifecycleComponent, 0)
+	resolved := 0
+	for resolved < len(mgr.children) {
+		layer := make([]LifecycleComponent, 0)
+		for _, child := range mgr.children {
+			if pending[child] == 0 {
+				layer = append(layer, child)
+			}
+		}
+		if len(layer) == 0 {
+			return nil, &DependencyError{Component: mgr.Name,
+				Err: fmt.Errorf("dependency cycle detected in '%s': %s", mgr.Name, mgr.describeCycle(pending))}
+		}
+		for _, child := range layer {
+			pending[child] = -1
+			for _, dependent := range dependents[child] {
+				pending[dependent]--
+			}
+		}
+		layers = append(layers, layer)
+		resolved += len(layer)
+	}
+	return layers, nil
+}
+
+// Find a cycle among components with unresolved dependencies and describe it. Expects
+// the caller to hold the manager lock.
+func (mgr *LifecycleManager) describeCycle(pending map[LifecycleComponent]int) string {
+	visiting := make(map[LifecycleComponent]int)
+	path := make([]LifecycleComponent, 0)
+
+	var visit func(LifecycleComponent) []LifecycleComponent
+	visit = func(current LifecycleComponent) []LifecycleComponent {
+		if idx, ok := visiting[current]; ok {
+			return append(path[idx:], current)
+		}
+		visiting[current] = len(path)
+		path = append(path, current)
+		for _, dep := range mgr.dependencies[current] {
+			if pending[dep] > 0 {
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		delete(visiting, current)
+		return nil
+	}
+
+	for _, child := range mgr.children {
+		if pending[child] > 0 {
+			if cycle := visit(child); cycle != nil {
+				names := make([]string, 0)
+				for _, comp := range cycle {
+					names = append(names, comp.Lifecycle().Name)
+				}
+				return strings.Join(names, " -> ")
+			}
+		}
+	}
+	return "unable to resolve dependencies"
+}
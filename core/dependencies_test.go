@@ -0,0 +1,269 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Component that records the lifecycle steps it executes.
+type testComponent struct {
+	lifecycle *LifecycleManager
+	steps     *testSteps
+	fails     LifecyclePhase
+}
+
+func (tc *testComponent) Lifecycle() *LifecycleManager         { return tc.lifecycle }
+func (tc *testComponent) Initialize(ctx context.Context) error { return tc.lifecycle.Initialize(ctx) }
+func (tc *testComponent) ExecuteInitialize(ctx context.Context) error {
+	return tc.step(PhaseInitialize)
+}
+func (tc *testComponent) Start(ctx context.Context) error            { return tc.lifecycle.Start(ctx) }
+func (tc *testComponent) ExecuteStart(ctx context.Context) error     { return tc.step(PhaseStart) }
+func (tc *testComponent) Stop(ctx context.Context) error             { return tc.lifecycle.Stop(ctx) }
+func (tc *testComponent) ExecuteStop(ctx context.Context) error      { return tc.step(PhaseStop) }
+func (tc *testComponent) Terminate(ctx context.Context) error        { return tc.lifecycle.Terminate(ctx) }
+func (tc *testComponent) ExecuteTerminate(ctx context.Context) error { return tc.step(PhaseTerminate) }
+
+// Record a step, failing if the component is set to fail in the phase.
+func (tc *testComponent) step(phase LifecyclePhase) error {
+	tc.steps.add(fmt.Sprintf("%s %s", phase, tc.lifecycle.Name))
+	if phase == tc.fails {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+// Steps executed by a group of test components.
+type testSteps struct {
+	mutex sync.Mutex
+	all   []string
+}
+
+func (ts *testSteps) add(step string) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	ts.all = append(ts.all, step)
+}
+
+func (ts *testSteps) list() []string {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	return append([]string{}, ts.all...)
+}
+
+func newTestComponent(name string, steps *testSteps) *testComponent {
+	tc := &testComponent{steps: steps}
+	tc.lifecycle = NewLifecycleManager(name, tc, NewNoOpLifecycleCallbacks())
+	return tc
+}
+
+// Build a parent with children registered in the order given. Dependencies are listed by
+// child name.
+func newTestTree(t *testing.T, names []string, deps map[string][]string) (*testComponent, map[string]*testComponent) {
+	steps := &testSteps{}
+	parent := newTestComponent("parent", steps)
+	children := make(map[string]*testComponent)
+	for _, name := range names {
+		children[name] = newTestComponent(name, steps)
+		dependencies := make([]LifecycleComponent, 0)
+		for _, dep := range deps[name] {
+			dependencies = append(dependencies, children[dep])
+		}
+		require.NoError(t, parent.lifecycle.AddChild(children[name], dependencies...))
+	}
+	return parent, children
+}
+
+// Get names of components in each dependency layer.
+func layerNames(layers [][]LifecycleComponent) [][]string {
+	names := make([][]string, 0)
+	for _, layer := range layers {
+		lnames := make([]string, 0)
+		for _, child := range layer {
+			lnames = append(lnames, child.Lifecycle().Name)
+		}
+		names = append(names, lnames)
+	}
+	return names
+}
+
+func TestAddChildValidatesDependencies(t *testing.T) {
+	steps := &testSteps{}
+	parent := newTestComponent("parent", steps)
+	a := newTestComponent("a", steps)
+	require.NoError(t, parent.lifecycle.AddChild(a))
+
+	b := newTestComponent("b", steps)
+	tests := []struct {
+		name         string
+		child        LifecycleComponent
+		dependencies []LifecycleComponent
+		err          string
+	}{
+		{"already registered", a, nil, "component 'a' is already registered with 'parent'"},
+		{"depends on itself", b, []LifecycleComponent{b}, "component 'b' can not depend on itself"},
+		{"unregistered dependency", b, []LifecycleComponent{newTestComponent("c", steps)},
+			"component 'b' depends on 'c' which is not registered with 'parent'"},
+		{"registered dependency", b, []LifecycleComponent{a}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := parent.lifecycle.AddChild(test.child, test.dependencies...)
+			if test.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.IsType(t, &DependencyError{}, err)
+			assert.EqualError(t, err, test.err)
+		})
+	}
+	assert.Len(t, parent.lifecycle.Children(), 2)
+}
+
+func TestDependencyLayers(t *testing.T) {
+	tests := []struct {
+		name   string
+		names  []string
+		deps   map[string][]string
+		layers [][]string
+	}{
+		{"no children", nil, nil, [][]string{}},
+		{"independent", []string{"a", "b", "c"}, nil, [][]string{{"a", "b", "c"}}},
+		{"chain", []string{"a", "b", "c"}, map[string][]string{"b": {"a"}, "c": {"b"}},
+			[][]string{{"a"}, {"b"}, {"c"}}},
+		{"diamond", []string{"a", "b", "c", "d"}, map[string][]string{"b": {"a"}, "c": {"a"}, "d": {"b", "c"}},
+			[][]string{{"a"}, {"b", "c"}, {"d"}}},
+		{"registration order", []string{"b", "a", "c"}, map[string][]string{"c": {"a"}},
+			[][]string{{"b", "a"}, {"c"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parent, _ := newTestTree(t, test.names, test.deps)
+			layers, err := parent.lifecycle.dependencyLayers()
+			require.NoError(t, err)
+			assert.Equal(t, test.layers, layerNames(layers))
+		})
+	}
+}
+
+func TestDependencyLayersCycle(t *testing.T) {
+	parent, children := newTestTree(t, []string{"a", "b", "c"}, map[string][]string{"b": {"a"}, "c": {"b"}})
+
+	// Cycles can not be registered, so create one directly.
+	parent.lifecycle.dependencies[children["a"]] = []LifecycleComponent{children["c"]}
+	_, err := parent.lifecycle.dependencyLayers()
+	require.IsType(t, &DependencyError{}, err)
+	assert.EqualError(t, err, "dependency cycle detected in 'parent': a -> c -> b -> a")
+
+	// Layering fails before any child is processed and children are not rolled back.
+	err = parent.Initialize(context.Background())
+	require.IsType(t, &LifecycleError{}, err)
+	lerr := err.(*LifecycleError)
+	assert.Len(t, lerr.Failures, 1)
+	assert.Empty(t, lerr.Rollback)
+	assert.Equal(t, []string{"initialize parent", "terminate parent"}, parent.steps.list())
+	assert.Equal(t, Uninitialized, parent.lifecycle.State())
+}
+
+func TestChildRollback(t *testing.T) {
+	names := []string{"a", "b", "c", "d"}
+	deps := map[string][]string{"b": {"a"}, "c": {"a"}, "d": {"b", "c"}}
+	tests := []struct {
+		name   string
+		phase  LifecyclePhase
+		fails  string
+		steps  []string
+		states map[string]LifecycleState
+	}{
+		{"initialize first layer", PhaseInitialize, "a",
+			[]string{"initialize parent", "initialize a", "terminate parent"},
+			map[string]LifecycleState{"a": Uninitialized, "b": Uninitialized, "d": Uninitialized}},
+		{"initialize last layer", PhaseInitialize, "d",
+			[]string{"initialize parent", "initialize a", "initialize b", "initialize c", "initialize d",
+				"terminate b", "terminate c", "terminate a", "terminate parent"},
+			map[string]LifecycleState{"a": Terminated, "b": Terminated, "c": Terminated, "d": Uninitialized}},
+		{"start middle layer", PhaseStart, "b",
+			[]string{"start parent", "start a", "start b", "start c", "stop c", "stop a", "stop parent"},
+			map[string]LifecycleState{"a": Stopped, "b": Initialized, "c": Stopped, "d": Initialized}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parent, children := newTestTree(t, names, deps)
+			children[test.fails].fails = test.phase
+			if test.phase == PhaseStart {
+				require.NoError(t, parent.Initialize(context.Background()))
+				parent.steps.all = nil
+			}
+
+			var err error
+			if test.phase == PhaseInitialize {
+				err = parent.Initialize(context.Background())
+			} else {
+				err = parent.Start(context.Background())
+			}
+			require.IsType(t, &LifecycleError{}, err)
+			lerr := err.(*LifecycleError)
+			require.Len(t, lerr.Failures, 1)
+			assert.Equal(t, test.fails, lerr.Failures[0].Component)
+			assert.Empty(t, lerr.Rollback)
+
+			// Children within a layer run concurrently, so only compare order across layers.
+			assert.ElementsMatch(t, test.steps, parent.steps.list())
+			assertLayerOrder(t, parent.steps.list(), test.steps)
+			for name, state := range test.states {
+				assert.Equal(t, state, children[name].lifecycle.State(), name)
+			}
+		})
+	}
+}
+
+// Verify that steps happened in the expected order, allowing steps for b and c (which
+// share a layer) to happen in either order.
+func assertLayerOrder(t *testing.T, actual []string, expected []string) {
+	position := func(steps []string, step string) int {
+		for idx, candidate := range steps {
+			if candidate == step {
+				return idx
+			}
+		}
+		return -1
+	}
+	for idx := 1; idx < len(expected); idx++ {
+		prev, current := expected[idx-1], expected[idx]
+		if sameLayer(prev, current) {
+			continue
+		}
+		assert.Less(t, position(actual, prev), position(actual, current), "%s before %s", prev, current)
+	}
+}
+
+// Indicates whether two steps are for the same phase of components in the same layer.
+func sameLayer(first string, second string) bool {
+	var fphase, fname, sphase, sname string
+	fmt.Sscanf(first, "%s %s", &fphase, &fname)
+	fmt.Sscanf(second, "%s %s", &sphase, &sname)
+	shared := map[string]bool{"b": true, "c": true}
+	return fphase == sphase && shared[fname] && shared[sname]
+}
@@ -16,6 +16,13 @@
 
 package core
 
+import (
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
 const (
 	ENV_INSTANCE_ID        = "DC_INSTANCE_ID"
 	ENV_TENANT_ID          = "DC_TENANT_ID"
@@ -23,4 +30,35 @@ const (
 	ENV_MICROSERVICE_ID    = "DC_MICROSERVICE_ID"
 	ENV_MICROSERVICE_NAME  = "DC_MICROSERVICE_NAME"
 	ENV_MS_FUNCTIONAL_AREA = "DC_MS_FUNCTIONAL_AREA"
+
+	ENV_INITIALIZE_TIMEOUT = "DC_INITIALIZE_TIMEOUT"
+	ENV_START_TIMEOUT      = "DC_START_TIMEOUT"
+	ENV_STOP_TIMEOUT       = "DC_STOP_TIMEOUT"
+	ENV_TERMINATE_TIMEOUT  = "DC_TERMINATE_TIMEOUT"
+
+	ENV_SHUTDOWN_DRAIN_PERIOD = "DC_SHUTDOWN_DRAIN_PERIOD"
+	ENV_SHUTDOWN_TIMEOUT      = "DC_SHUTDOWN_TIMEOUT"
+
+	ENV_CONFIG_POLL_INTERVAL = "DC_CONFIG_POLL_INTERVAL"
+
+	ENV_INSTANCE_CONFIG_PATH     = "DC_INSTANCE_CONFIG_PATH"
+	ENV_MICROSERVICE_CONFIG_PATH = "DC_MICROSERVICE_CONFIG_PATH"
+	ENV_DEV_MODE                 = "DC_DEV_MODE"
+
+	ENV_HEALTH_PORT = "DC_HEALTH_PORT"
 )
+
+// Parse a duration (e.g. "30s") from an environment variable. Returns zero if the
+// variable is not set or can not be parsed.
+func durationFromEnv(name string) time.Duration {
+	value, found := os.LookupEnv(name)
+	if !found {
+		return 0
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Warn().Err(err).Str("variable", name).Msg("Ignoring invalid duration in environment variable.")
+		return 0
+	}
+	return duration
+}
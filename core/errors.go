@@ -0,0 +1,178 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	EXIT_CODE_SUCCESS         = 0
+	EXIT_CODE_FAILURE         = 1
+	EXIT_CODE_CONFIGURATION   = 2
+	EXIT_CODE_INFRASTRUCTURE  = 3
+	EXIT_CODE_CALLBACK        = 4
+	EXIT_CODE_FORCED_SHUTDOWN = 5
+)
+
+// Error caused by missing or invalid configuration.
+type ConfigurationError struct {
+	Err error
+}
+
+func (cerr *ConfigurationError) Error() string {
+	return fmt.Sprintf("invalid configuration: %s", cerr.Err.Error())
+}
+
+func (cerr *ConfigurationError) Unwrap() error {
+	return cerr.Err
+}
+
+// Error caused by a component failing to interact with infrastructure such as
+// datastores or message brokers.
+type InfrastructureError struct {
+	Component string
+	Err       error
+}
+
+func (ierr *InfrastructureError) Error() string {
+	return ierr.Err.Error()
+}
+
+func (ierr *InfrastructureError) Unwrap() error {
+	return ierr.Err
+}
+
+// Error returned by a user-supplied lifecycle callback.
+type CallbackError struct {
+	Component string
+	Phase     LifecyclePhase
+	Err       error
+}
+
+func (cberr *CallbackError) Error() string {
+	return fmt.Sprintf("%s callback failed: %s", cberr.Phase, cberr.Err.Error())
+}
+
+func (cberr *CallbackError) Unwrap() error {
+	return cberr.Err
+}
+
+// Map an error returned from running a microservice to a process exit code.
+func ExitCode(err error) int {
+	if err == nil {
+		return EXIT_CODE_SUCCESS
+	}
+	var cfgerr *ConfigurationError
+	if errors.As(err, &cfgerr) {
+		return EXIT_CODE_CONFIGURATION
+	}
+	var cberr *CallbackError
+	if errors.As(err, &cberr) {
+		return EXIT_CODE_CALLBACK
+	}
+	var infraerr *InfrastructureError
+	if errors.As(err, &infraerr) {
+		return EXIT_CODE_INFRASTRUCTURE
+	}
+	return EXIT_CODE_FAILURE
+}
+
+// Failure of a single component during a lifecycle phase.
+type ComponentFailure struct {
+	Component string
+	Err       error
+}
+
+// Error returned when a lifecycle phase fails. Lists the failure of each component that
+// caused the phase to fail along with any failures that happened while rolling back
+// components that had already advanced.
+type LifecycleError struct {
+	Component string
+	Phase     LifecyclePhase
+	Failures  []ComponentFailure
+	Rollback  []ComponentFailure
+}
+
+// Create a lifecycle error for the given component and phase.
+func newLifecycleError(component string, phase LifecyclePhase) *LifecycleError {
+	return &LifecycleError{
+		Component: component,
+		Phase:     phase,
+		Failures:  make([]ComponentFailure, 0),
+		Rollback:  make([]ComponentFailure, 0),
+	}
+}
+
+// Add a failure for a component. Nested lifecycle errors are flattened so that the
+// failures reported are those of the components that actually failed.
+func (lerr *LifecycleError) addFailure(component string, err error) {
+	if err == nil {
+		return
+	}
+	if nested, ok := err.(*LifecycleError); ok {
+		lerr.Failures = append(lerr.Failures, nested.Failures...)
+		lerr.Rollback = append(lerr.Rollback, nested.Rollback...)
+		return
+	}
+	lerr.Failures = append(lerr.Failures, ComponentFailure{Component: component, Err: err})
+}
+
+// Add a failure that happened while rolling back a component.
+func (lerr *LifecycleError) addRollback(component string, err error) {
+	if err == nil {
+		return
+	}
+	if nested, ok := err.(*LifecycleError); ok {
+		lerr.Rollback = append(lerr.Rollback, nested.Failures...)
+		lerr.Rollback = append(lerr.Rollback, nested.Rollback...)
+		return
+	}
+	lerr.Rollback = append(lerr.Rollback, ComponentFailure{Component: component, Err: err})
+}
+
+// Indicates whether any failures were recorded.
+func (lerr *LifecycleError) hasFailures() bool {
+	return len(lerr.Failures) > 0
+}
+
+// Describe all failures in a single message.
+func (lerr *LifecycleError) Error() string {
+	failures := make([]string, 0)
+	for _, failure := range lerr.Failures {
+		failures = append(failures, fmt.Sprintf("%s: %s", failure.Component, failure.Err.Error()))
+	}
+	msg := fmt.Sprintf("unable to %s '%s': %s", lerr.Phase, lerr.Component, strings.Join(failures, "; "))
+	if len(lerr.Rollback) > 0 {
+		rollback := make([]string, 0)
+		for _, failure := range lerr.Rollback {
+			rollback = append(rollback, fmt.Sprintf("%s: %s", failure.Component, failure.Err.Error()))
+		}
+		msg += fmt.Sprintf(" (rollback failed for %s)", strings.Join(rollback, "; "))
+	}
+	return msg
+}
+
+// Unwrap to the first component failure.
+func (lerr *LifecycleError) Unwrap() error {
+	if len(lerr.Failures) == 0 {
+		return nil
+	}
+	return lerr.Failures[0].Err
+}
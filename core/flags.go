@@ -0,0 +1,173 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/devicechain-io/dc-microservice/config"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DEFAULT_INSTANCE_CONFIG_PATH    = "/etc/dci-config/instance"
+	DEFAULT_MICROSERVICE_CONFIG_DIR = "/etc/dct-config"
+
+	FLAG_INSTANCE_CONFIG     = "instance-config"
+	FLAG_MICROSERVICE_CONFIG = "microservice-config"
+	FLAG_DEV_MODE            = "dev"
+	FLAG_INSTANCE_SCHEMA     = "instance-schema"
+	FLAG_HEALTH_PORT         = "health-port"
+)
+
+// Settings passed on the command line.
+type Flags struct {
+	InstanceConfig     string
+	MicroserviceConfig string
+	DevMode            bool
+	InstanceSchema     bool
+	HealthPort         int
+}
+
+// Parse the settings in command line arguments (without the program name). A private flag
+// set is used so that flags defined by services on the default flag set do not conflict.
+// Arguments that are not settings are ignored and invalid values are logged rather than
+// exiting the process.
+func ParseFlags(args []string) *Flags {
+	flags := &Flags{}
+	fs := flag.NewFlagSet("microservice", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&flags.InstanceConfig, FLAG_INSTANCE_CONFIG, "",
+		"Path of instance configuration file (default "+DEFAULT_INSTANCE_CONFIG_PATH+")")
+	fs.StringVar(&flags.MicroserviceConfig, FLAG_MICROSERVICE_CONFIG, "",
+		"Path of microservice configuration file (default "+DEFAULT_MICROSERVICE_CONFIG_DIR+"/<functional area>)")
+	fs.BoolVar(&flags.DevMode, FLAG_DEV_MODE, false,
+		"Run outside of Kubernetes, using default configuration where configuration files are missing")
+	fs.BoolVar(&flags.InstanceSchema, FLAG_INSTANCE_SCHEMA, false,
+		"Print the JSON Schema for instance configuration")
+	fs.IntVar(&flags.HealthPort, FLAG_HEALTH_PORT, 0,
+		fmt.Sprintf("Port on which health endpoints are served (default %d)", HEALTH_PORT))
+
+	for _, known := range knownArgs(fs, args) {
+		err := fs.Parse(known)
+		if err != nil {
+			log.Warn().Err(err).Msg("Ignoring invalid command line flag.")
+		}
+	}
+	return flags
+}
+
+// Filter arguments down to flags defined in a flag set, each along with its value.
+func knownArgs(fs *flag.FlagSet, args []string) [][]string {
+	known := make([][]string, 0)
+	for idx := 0; idx < len(args); idx++ {
+		arg := args[idx]
+		if arg == "--" {
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		hasValue := strings.Contains(name, "=")
+		if hasValue {
+			name = name[:strings.Index(name, "=")]
+		}
+		defined := fs.Lookup(name)
+		if defined == nil {
+			continue
+		}
+		if _, isBool := defined.Value.(interface{ IsBoolFlag() bool }); !hasValue && !isBool && idx+1 < len(args) {
+			known = append(known, []string{arg, args[idx+1]})
+			idx++
+			continue
+		}
+		known = append(known, []string{arg})
+	}
+	return known
+}
+
+// Indicates whether the instance configuration schema was requested on the command line.
+// Services check this before creating the microservice and call PrintInstanceSchema.
+func InstanceSchemaRequested() bool {
+	return ParseFlags(os.Args[1:]).InstanceSchema
+}
+
+// Write the instance configuration schema (JSON Schema) to the given writer.
+func PrintInstanceSchema(out io.Writer) error {
+	schema, err := config.InstanceConfigurationSchemaJSON()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(schema))
+	return err
+}
+
+// Resolve a setting from a command line flag, then an environment variable, then a default.
+func stringSetting(flagValue string, env string, def string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if value, found := os.LookupEnv(env); found && value != "" {
+		return value
+	}
+	return def
+}
+
+// Resolve a boolean setting from a command line flag or an environment variable.
+func boolSetting(flagValue bool, env string) bool {
+	if flagValue {
+		return true
+	}
+	value, found := os.LookupEnv(env)
+	if !found {
+		return false
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Warn().Err(err).Str("variable", env).Msg("Ignoring invalid boolean in environment variable.")
+		return false
+	}
+	return parsed
+}
+
+// Resolve a port setting from a command line flag, then an environment variable, then a
+// default. Values outside of the valid port range are logged and ignored.
+func portSetting(flagValue int, env string, def int) int {
+	valid := func(port int) bool { return port > 0 && port <= 65535 }
+	if flagValue != 0 {
+		if valid(flagValue) {
+			return flagValue
+		}
+		log.Warn().Int("port", flagValue).Msg("Ignoring invalid port in command line flag.")
+	}
+	value, found := os.LookupEnv(env)
+	if !found || value == "" {
+		return def
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || !valid(port) {
+		log.Warn().Str("variable", env).Str("value", value).Msg("Ignoring invalid port in environment variable.")
+		return def
+	}
+	return port
+}
@@ -0,0 +1,48 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthPortSetting(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		env      string
+		expected int
+	}{
+		{"default", nil, "", HEALTH_PORT},
+		{"flag", []string{"--health-port", "9090"}, "", 9090},
+		{"flag with value", []string{"-health-port=9090"}, "9091", 9090},
+		{"environment", nil, "9091", 9091},
+		{"invalid flag", []string{"--health-port", "http"}, "9091", 9091},
+		{"flag out of range", []string{"--health-port", "70000"}, "9091", 9091},
+		{"invalid environment", nil, "http", HEALTH_PORT},
+		{"environment out of range", nil, "0", HEALTH_PORT},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(ENV_HEALTH_PORT, test.env)
+			flags := ParseFlags(test.args)
+			assert.Equal(t, test.expected, portSetting(flags.HealthPort, ENV_HEALTH_PORT, HEALTH_PORT))
+		})
+	}
+}
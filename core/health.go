@@ -0,0 +1,254 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	HEALTH_PORT          = 8081
+	HEALTH_CHECK_TIMEOUT = 5 * time.Second
+
+	HEALTH_STATUS_UP   = "UP"
+	HEALTH_STATUS_DOWN = "DOWN"
+)
+
+// Function that verifies a component is able to reach its infrastructure.
+type HealthCheck func(ctx context.Context) error
+
+// Health of a single component or health check.
+type ComponentHealth struct {
+	State  string `json:"state,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Overall health of the microservice with a breakdown per component.
+type HealthReport struct {
+	Status     string                      `json:"status"`
+	Live       bool                        `json:"live"`
+	Ready      bool                        `json:"ready"`
+	Paused     bool                        `json:"paused"`
+	Components map[string]*ComponentHealth `json:"components"`
+}
+
+// Serves health, readiness and liveness endpoints for the microservice.
+type HealthServer struct {
+	Microservice *Microservice
+	Server       *http.Server
+	Port         int
+
+	checks map[string]HealthCheck
+	mutex  sync.RWMutex
+}
+
+// Create a new health server.
+func NewHealthServer(ms *Microservice) *HealthServer {
+	return &HealthServer{
+		Microservice: ms,
+		Port:         HEALTH_PORT,
+		checks:       make(map[string]HealthCheck),
+	}
+}
+
+// Register a health check. Results are reported under the given name, which must match
+// the lifecycle name of the component being checked. Checks are only run while the
+// component is part of the microservice lifecycle and is started or paused.
+func (hs *HealthServer) AddCheck(name string, check HealthCheck) {
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+	hs.checks[name] = check
+}
+
+// Collect lifecycle managers for a component and all of its descendants.
+func collectLifecycles(mgr *LifecycleManager) []*LifecycleManager {
+	result := []*LifecycleManager{mgr}
+	for _, child := range mgr.Children() {
+		result = append(result, collectLifecycles(child.Lifecycle())...)
+	}
+	return result
+}
+
+// Indicates whether the microservice process is alive.
+func (hs *HealthServer) Live() bool {
+	return hs.Microservice.Lifecycle().State() != Terminated
+}
+
+// Indicates whether a component is able to serve requests. Paused components continue
+// to serve reads during maintenance.
+func serving(state LifecycleState) bool {
+	return state == Started || state == Paused
+}
+
+// Indicates whether the microservice and all of its components are started (or paused
+// for maintenance). A microservice that is draining before shutdown is never ready.
+func (hs *HealthServer) Ready() bool {
+	if hs.Microservice.Draining() {
+		return false
+	}
+	for _, mgr := range collectLifecycles(hs.Microservice.Lifecycle()) {
+		if !serving(mgr.State()) {
+			return false
+		}
+	}
+	return true
+}
+
+// Run health checks and build a report of microservice health.
+func (hs *HealthServer) Check(ctx context.Context) *HealthReport {
+	report := &HealthReport{
+		Live:       hs.Live(),
+		Ready:      hs.Ready(),
+		Paused:     hs.Microservice.Paused(),
+		Components: make(map[string]*ComponentHealth),
+	}
+	for _, mgr := range collectLifecycles(hs.Microservice.Lifecycle()) {
+		status := HEALTH_STATUS_UP
+		if !serving(mgr.State()) {
+			status = HEALTH_STATUS_DOWN
+		}
+		report.Components[mgr.Name] = &ComponentHealth{State: mgr.State().String(), Status: status}
+	}
+
+	// Run health checks concurrently.
+	hs.mutex.RLock()
+	checks := make(map[string]HealthCheck)
+	for name, check := range hs.checks {
+		checks[name] = check
+	}
+	hs.mutex.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, HEALTH_CHECK_TIMEOUT)
+	defer cancel()
+	results := make(map[string]error)
+	var rmutex sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		// Only check registered components that are started or paused.
+		if component, ok := report.Components[name]; !ok || component.Status != HEALTH_STATUS_UP {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+			err := runHealthCheck(ctx, check)
+			rmutex.Lock()
+			results[name] = err
+			rmutex.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	// Merge check results into component breakdown.
+	healthy := report.Ready
+	for name, err := range results {
+		component := report.Components[name]
+		if err != nil {
+			component.Status = HEALTH_STATUS_DOWN
+			component.Error = err.Error()
+			healthy = false
+		}
+	}
+	report.Status = HEALTH_STATUS_DOWN
+	if healthy {
+		report.Status = HEALTH_STATUS_UP
+	}
+	return report
+}
+
+// Run a health check, converting a panic into an error.
+func runHealthCheck(ctx context.Context, check HealthCheck) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("health check panicked: %v", r)
+		}
+	}()
+	return check(ctx)
+}
+
+// Write a JSON report with a status code based on whether the probe succeeded.
+func writeHealthResponse(w http.ResponseWriter, ok bool, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	err := json.NewEncoder(w).Encode(body)
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to write health response.")
+	}
+}
+
+// Handle request for full health report.
+func (hs *HealthServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	report := hs.Check(r.Context())
+	writeHealthResponse(w, report.Status == HEALTH_STATUS_UP, report)
+}
+
+// Handle readiness probe. Ready only if all components are started (or paused) and checks pass.
+func (hs *HealthServer) handleReady(w http.ResponseWriter, r *http.Request) {
+	if !hs.Ready() {
+		writeHealthResponse(w, false, &ComponentHealth{State: hs.Microservice.Lifecycle().State().String(),
+			Status: HEALTH_STATUS_DOWN})
+		return
+	}
+	report := hs.Check(r.Context())
+	writeHealthResponse(w, report.Status == HEALTH_STATUS_UP, report)
+}
+
+// Handle liveness probe. Does not depend on infrastructure checks.
+func (hs *HealthServer) handleLive(w http.ResponseWriter, r *http.Request) {
+	live := hs.Live()
+	status := HEALTH_STATUS_UP
+	if !live {
+		status = HEALTH_STATUS_DOWN
+	}
+	writeHealthResponse(w, live, &ComponentHealth{State: hs.Microservice.Lifecycle().State().String(), Status: status})
+}
+
+// Start serving health endpoints in the background.
+func (hs *HealthServer) Start() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", hs.handleHealth)
+	mux.HandleFunc("/readyz", hs.handleReady)
+	mux.HandleFunc("/livez", hs.handleLive)
+	hs.Server = &http.Server{Addr: fmt.Sprintf(":%d", hs.Port), Handler: mux}
+
+	go func() {
+		log.Info().Int("port", hs.Port).Msg("Starting health server.")
+		if err := hs.Server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Error().Err(err).Msg("Error starting health server.")
+		}
+	}()
+}
+
+// Stop serving health endpoints.
+func (hs *HealthServer) Stop(ctx context.Context) error {
+	if hs.Server == nil {
+		return nil
+	}
+	return hs.Server.Shutdown(ctx)
+}
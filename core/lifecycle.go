@@ -19,12 +19,26 @@ package core
 import (
 	"context"
 	"errors"
+	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
 type LifecycleState int64
 
+// Phases a component moves through during its lifecycle.
+type LifecyclePhase string
+
+const (
+	PhaseInitialize LifecyclePhase = "initialize"
+	PhaseStart      LifecyclePhase = "start"
+	PhaseStop       LifecyclePhase = "stop"
+	PhaseTerminate  LifecyclePhase = "terminate"
+	PhasePause      LifecyclePhase = "pause"
+	PhaseResume     LifecyclePhase = "resume"
+)
+
 // Enumeration of lifecycle states
 //go:generate stringer -type=LifecycleState
 const (
@@ -37,10 +51,16 @@ const (
 	Stopped
 	Terminating
 	Terminated
+	Pausing
+	Paused
+	Resuming
 )
 
 // Common lifecycle concept for components
 type LifecycleComponent interface {
+	// Get the lifecycle manager that tracks component state.
+	Lifecycle() *LifecycleManager
+
 	// Invokes lifecycle initialization.
 	Initialize(ctx context.Context) error
 
@@ -105,100 +125,313 @@ func NewNoOpLifecycleCallbacks() LifecycleCallbacks {
 	}
 }
 
+// Manages lifecycle state of a component and any child components it owns. Children
+// are initialized/started in dependency order after the parent and are stopped/terminated
+// in reverse dependency order before the parent. Children with no dependency relationship
+// are processed concurrently.
+//
+// Lifecycle operations on a manager are serialized, so a call to Stop made while Start
+// is running waits for Start to complete before validating the state transition.
 type LifecycleManager struct {
 	Name      string
 	Component LifecycleComponent
 	Callbacks LifecycleCallbacks
+
+	state        LifecycleState
+	timeouts     LifecycleTimeouts
+	restarts     RestartPolicy
+	metrics      *LifecycleMetrics
+	parent       *LifecycleManager
+	children     []LifecycleComponent
+	dependencies map[LifecycleComponent][]LifecycleComponent
+	listeners    []lifecycleSubscription
+	nextListener int
+	resumed      chan struct{}
+	abandoned    chan struct{}
+	mutex        sync.RWMutex
+	operation    sync.Mutex
+}
+
+// Transition of a component from one lifecycle state to another.
+type LifecycleEvent struct {
+	Component string
+	Previous  LifecycleState
 	State     LifecycleState
+	Error     error
+	Timestamp time.Time
+}
+
+// Function invoked when a lifecycle event occurs.
+type LifecycleListener func(LifecycleEvent)
+
+// Listener registered with a lifecycle manager.
+type lifecycleSubscription struct {
+	id       int
+	listener LifecycleListener
 }
 
 // Create a new lifecycle manager
-func NewLifecycleManager(name string, component LifecycleComponent, callbacks LifecycleCallbacks) LifecycleManager {
-	mgr := LifecycleManager{Name: name, Component: component, Callbacks: callbacks, State: Uninitialized}
+func NewLifecycleManager(name string, component LifecycleComponent, callbacks LifecycleCallbacks) *LifecycleManager {
+	mgr := &LifecycleManager{Name: name, Component: component, Callbacks: callbacks, state: Uninitialized}
+	mgr.dependencies = make(map[LifecycleComponent][]LifecycleComponent)
 	return mgr
 }
 
+// Register a child component whose lifecycle is driven by this manager. The child will
+// not be initialized/started until all of its dependencies (which must already be children
+// of this manager) have been. Since dependencies are registered first, they can not form a
+// cycle. Lifecycle events of the child are delivered to subscribers of this manager.
+func (mgr *LifecycleManager) AddChild(child LifecycleComponent, dependencies ...LifecycleComponent) error {
+	mgr.mutex.Lock()
+	err := mgr.checkDependencies(child, dependencies)
+	if err != nil {
+		mgr.mutex.Unlock()
+		return err
+	}
+	mgr.children = append(mgr.children, child)
+	mgr.dependencies[child] = append([]LifecycleComponent{}, dependencies...)
+	mgr.mutex.Unlock()
+
+	clc := child.Lifecycle()
+	clc.mutex.Lock()
+	clc.parent = mgr
+	clc.mutex.Unlock()
+	return nil
+}
+
+// Get the components a child depends on.
+func (mgr *LifecycleManager) Dependencies(child LifecycleComponent) []LifecycleComponent {
+	mgr.mutex.RLock()
+	defer mgr.mutex.RUnlock()
+	return append([]LifecycleComponent{}, mgr.dependencies[child]...)
+}
+
+// Get list of child components in registration order.
+func (mgr *LifecycleManager) Children() []LifecycleComponent {
+	mgr.mutex.RLock()
+	defer mgr.mutex.RUnlock()
+	return append([]LifecycleComponent{}, mgr.children...)
+}
+
+// Get current lifecycle state.
+func (mgr *LifecycleManager) State() LifecycleState {
+	mgr.mutex.RLock()
+	defer mgr.mutex.RUnlock()
+	return mgr.state
+}
+
+// Subscribe to lifecycle events for this component and all of its descendants. Listeners
+// are invoked synchronously as part of the transition and should not block. The returned
+// function removes the subscription.
+func (mgr *LifecycleManager) Subscribe(listener LifecycleListener) func() {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	id := mgr.nextListener
+	mgr.nextListener++
+	mgr.listeners = append(mgr.listeners, lifecycleSubscription{id: id, listener: listener})
+
+	return func() {
+		mgr.mutex.Lock()
+		defer mgr.mutex.Unlock()
+		for idx, sub := range mgr.listeners {
+			if sub.id == id {
+				mgr.listeners = append(mgr.listeners[:idx], mgr.listeners[idx+1:]...)
+				return
+			}
+		}
+	}
+}
+
 // Set lifecycle state on manager and print the updated state
 func (mgr *LifecycleManager) SetLifecycleState(state LifecycleState) {
-	log.Info().Str("component", mgr.Name).Str("state", state.String()).Msg("Updating lifecycle state")
-	mgr.State = state
+	mgr.setLifecycleState(state, nil)
+}
+
+// Set lifecycle state along with the error that caused the transition (if any).
+func (mgr *LifecycleManager) setLifecycleState(state LifecycleState, err error) {
+	if err != nil {
+		log.Warn().Err(err).Str("component", mgr.Name).Str("state", state.String()).Msg("Updating lifecycle state after failure")
+	} else {
+		log.Info().Str("component", mgr.Name).Str("state", state.String()).Msg("Updating lifecycle state")
+	}
+	mgr.mutex.Lock()
+	prev := mgr.state
+	mgr.state = state
+	mgr.mutex.Unlock()
+
+	if metrics := mgr.Metrics(); metrics != nil {
+		metrics.State.WithLabelValues(mgr.Name).Set(float64(state))
+	}
+
+	mgr.notify(LifecycleEvent{
+		Component: mgr.Name,
+		Previous:  prev,
+		State:     state,
+		Error:     err,
+		Timestamp: time.Now(),
+	})
+}
+
+// Deliver an event to listeners on this manager and its ancestors.
+func (mgr *LifecycleManager) notify(event LifecycleEvent) {
+	mgr.mutex.RLock()
+	listeners := make([]LifecycleListener, 0, len(mgr.listeners))
+	for _, sub := range mgr.listeners {
+		listeners = append(listeners, sub.listener)
+	}
+	parent := mgr.parent
+	mgr.mutex.RUnlock()
+
+	for _, listener := range listeners {
+		listener(event)
+	}
+	if parent != nil {
+		parent.notify(event)
+	}
 }
 
-// Handle component initialization
+// Handle component initialization. Components that were terminated (for instance, as
+// part of rolling back a failed startup) may be initialized again. Failures are retried
+// based on the restart policy.
 func (mgr *LifecycleManager) Initialize(ctx context.Context) error {
-	if mgr.State != Uninitialized {
+	return mgr.withRestarts(ctx, PhaseInitialize, mgr.measured(PhaseInitialize, mgr.initialize))
+}
+
+// Run a single initialization attempt.
+func (mgr *LifecycleManager) initialize(ctx context.Context) error {
+	mgr.operation.Lock()
+	defer mgr.operation.Unlock()
+
+	state := mgr.State()
+	if state != Uninitialized && state != Terminated {
 		return errors.New("attempting to initialize component that is already initialized")
 	}
-	prev := mgr.State
+	prev := state
 	mgr.SetLifecycleState(Initializing)
 
+	// Bound the time allowed for the phase
+	ctx, cancel := mgr.phaseContext(ctx, PhaseInitialize)
+	defer cancel()
+
 	// Run callbacks that precede initialization
-	err := mgr.Callbacks.Initializer.Preprocess(ctx)
+	err := mgr.callback(ctx, PhaseInitialize, mgr.Callbacks.Initializer.Preprocess)
 	if err != nil {
-		mgr.SetLifecycleState(prev)
-		return err
+		return mgr.revert(prev, PhaseInitialize, err)
 	}
 
 	// Run primary initialization functionality
-	err = mgr.Component.ExecuteInitialize(ctx)
+	err = mgr.execute(ctx, PhaseInitialize, mgr.Component.ExecuteInitialize)
 	if err != nil {
-		mgr.SetLifecycleState(prev)
-		return err
+		return mgr.revert(prev, PhaseInitialize, err)
 	}
 
+	// Initialize child components
+	err = mgr.initializeChildren(ctx)
+
 	// Run callbacks that follow initialization
-	err = mgr.Callbacks.Initializer.Postprocess(ctx)
+	if err == nil {
+		err = mgr.callback(ctx, PhaseInitialize, mgr.Callbacks.Initializer.Postprocess)
+	}
+
+	// Initialize any children registered by postprocess callbacks
+	if err == nil {
+		err = mgr.initializeChildren(ctx)
+	}
+
+	// Terminate everything that was initialized if a later step failed (with a new
+	// context since the phase context may have expired)
 	if err != nil {
-		mgr.SetLifecycleState(prev)
-		return err
+		lerr := mgr.failure(PhaseInitialize, err)
+		rctx, rcancel := mgr.phaseContext(context.Background(), PhaseTerminate)
+		if !isDependencyError(err) {
+			lerr.addRollback(mgr.Name, mgr.terminateChildren(rctx))
+		}
+		lerr.addRollback(mgr.Name, mgr.execute(rctx, PhaseTerminate, mgr.Component.ExecuteTerminate))
+		rcancel()
+		mgr.setLifecycleState(prev, lerr)
+		return lerr
 	}
 
 	mgr.SetLifecycleState(Initialized)
 	return nil
 }
 
-// Handle component startup
+// Handle component startup. Failures are retried based on the restart policy.
 func (mgr *LifecycleManager) Start(ctx context.Context) error {
-	if mgr.State == Uninitialized {
+	return mgr.withRestarts(ctx, PhaseStart, mgr.measured(PhaseStart, mgr.start))
+}
+
+// Run a single startup attempt.
+func (mgr *LifecycleManager) start(ctx context.Context) error {
+	mgr.operation.Lock()
+	defer mgr.operation.Unlock()
+
+	state := mgr.State()
+	if state == Uninitialized {
 		return errors.New("attempting to start an uninitialized component")
 	}
-	if mgr.State == Starting {
+	if state == Starting {
 		return errors.New("attempting to start a component that is already starting")
 	}
-	if mgr.State == Started {
+	if state == Started {
 		return errors.New("attempting to start a component that is already started")
 	}
-	if mgr.State == Stopping {
+	if state == Stopping {
 		return errors.New("attempting to start a component that is stopping")
 	}
-	if mgr.State == Terminating {
+	if state == Terminating {
 		return errors.New("attempting to start a component that is terminating")
 	}
-	if mgr.State == Terminated {
+	if state == Terminated {
 		return errors.New("attempting to start a component that is terminated")
 	}
-	prev := mgr.State
+	if state == Pausing || state == Paused || state == Resuming {
+		return errors.New("attempting to start a component that is paused")
+	}
+	prev := state
 	mgr.SetLifecycleState(Starting)
 
+	// Bound the time allowed for the phase
+	ctx, cancel := mgr.phaseContext(ctx, PhaseStart)
+	defer cancel()
+
 	// Run callbacks that precede startup
-	err := mgr.Callbacks.Starter.Preprocess(ctx)
+	err := mgr.callback(ctx, PhaseStart, mgr.Callbacks.Starter.Preprocess)
 	if err != nil {
-		mgr.SetLifecycleState(prev)
-		return err
+		return mgr.revert(prev, PhaseStart, err)
 	}
 
 	// Run primary startup functionality
-	err = mgr.Component.ExecuteStart(ctx)
+	err = mgr.execute(ctx, PhaseStart, mgr.Component.ExecuteStart)
 	if err != nil {
-		mgr.SetLifecycleState(prev)
-		return err
+		return mgr.revert(prev, PhaseStart, err)
 	}
 
+	// Start child components
+	err = mgr.startChildren(ctx)
+
 	// Run callbacks that follow startup
-	err = mgr.Callbacks.Starter.Postprocess(ctx)
+	if err == nil {
+		err = mgr.callback(ctx, PhaseStart, mgr.Callbacks.Starter.Postprocess)
+	}
+
+	// Start any children registered by postprocess callbacks
+	if err == nil {
+		err = mgr.startChildren(ctx)
+	}
+
+	// Stop everything that was started if a later step failed (with a new context
+	// since the phase context may have expired)
 	if err != nil {
-		mgr.SetLifecycleState(prev)
-		return err
+		lerr := mgr.failure(PhaseStart, err)
+		rctx, rcancel := mgr.phaseContext(context.Background(), PhaseStop)
+		if !isDependencyError(err) {
+			lerr.addRollback(mgr.Name, mgr.stopChildren(rctx))
+		}
+		lerr.addRollback(mgr.Name, mgr.execute(rctx, PhaseStop, mgr.Component.ExecuteStop))
+		rcancel()
+		mgr.setLifecycleState(prev, lerr)
+		return lerr
 	}
 
 	mgr.SetLifecycleState(Started)
@@ -207,84 +440,275 @@ func (mgr *LifecycleManager) Start(ctx context.Context) error {
 
 // Handle component shutdown
 func (mgr *LifecycleManager) Stop(ctx context.Context) error {
-	if mgr.State == Uninitialized {
+	return mgr.measured(PhaseStop, mgr.stop)(ctx)
+}
+
+// Run shutdown logic.
+func (mgr *LifecycleManager) stop(ctx context.Context) error {
+	mgr.operation.Lock()
+	defer mgr.operation.Unlock()
+
+	state := mgr.State()
+	if state == Uninitialized {
 		return errors.New("attempting to stop an uninitialized component")
 	}
-	if mgr.State == Starting {
+	if state == Starting {
 		return errors.New("attempting to stop a component that is partially started")
 	}
-	if mgr.State == Stopping {
+	if state == Stopping {
 		return errors.New("attempting to stop a component that is already stopping")
 	}
-	if mgr.State == Stopped {
+	if state == Stopped {
 		return errors.New("attempting to stop a component that is already stopped")
 	}
-	if mgr.State == Terminating {
+	if state == Terminating {
 		return errors.New("attempting to stop a component that is terminating")
 	}
-	if mgr.State == Terminated {
+	if state == Terminated {
 		return errors.New("attempting to stop a component that is terminated")
 	}
-	prev := mgr.State
+	if state == Pausing || state == Resuming {
+		return errors.New("attempting to stop a component that is pausing or resuming")
+	}
+	prev := state
 	mgr.SetLifecycleState(Stopping)
 
+	// Bound the time allowed for the phase
+	ctx, cancel := mgr.phaseContext(ctx, PhaseStop)
+	defer cancel()
+
 	// Run callbacks that precede shutdown
-	err := mgr.Callbacks.Stopper.Preprocess(ctx)
+	err := mgr.callback(ctx, PhaseStop, mgr.Callbacks.Stopper.Preprocess)
 	if err != nil {
-		mgr.SetLifecycleState(prev)
-		return err
+		return mgr.revert(prev, PhaseStop, err)
+	}
+
+	// Stop child components
+	err = mgr.stopChildren(ctx)
+	if err != nil {
+		return mgr.revert(prev, PhaseStop, err)
 	}
 
 	// Run primary shutdown functionality
-	err = mgr.Component.ExecuteStop(ctx)
+	err = mgr.execute(ctx, PhaseStop, mgr.Component.ExecuteStop)
 	if err != nil {
-		mgr.SetLifecycleState(prev)
-		return err
+		return mgr.revert(prev, PhaseStop, err)
 	}
 
 	// Run callbacks that follow shutdown
-	err = mgr.Callbacks.Stopper.Postprocess(ctx)
+	err = mgr.callback(ctx, PhaseStop, mgr.Callbacks.Stopper.Postprocess)
 	if err != nil {
-		mgr.SetLifecycleState(prev)
-		return err
+		return mgr.revert(prev, PhaseStop, err)
 	}
 
+	// Release anything waiting for a paused component to resume
+	mgr.releaseResume()
+
 	mgr.SetLifecycleState(Stopped)
 	return nil
 }
 
-// Handle component termination
+// Handle component termination. Components that were initialized but never started
+// may be terminated directly.
 func (mgr *LifecycleManager) Terminate(ctx context.Context) error {
-	if mgr.State == Uninitialized {
+	return mgr.measured(PhaseTerminate, mgr.terminate)(ctx)
+}
+
+// Run termination logic.
+func (mgr *LifecycleManager) terminate(ctx context.Context) error {
+	mgr.operation.Lock()
+	defer mgr.operation.Unlock()
+
+	state := mgr.State()
+	if state == Uninitialized {
 		return errors.New("attempting to terminate component that is not initialized")
 	}
-	if mgr.State != Stopped {
+	if state != Stopped && state != Initialized {
 		return errors.New("attempting to terminate component that is not stopped")
 	}
-	prev := mgr.State
+	prev := state
 	mgr.SetLifecycleState(Terminating)
 
+	// Bound the time allowed for the phase
+	ctx, cancel := mgr.phaseContext(ctx, PhaseTerminate)
+	defer cancel()
+
 	// Run callbacks that precede terminate
-	err := mgr.Callbacks.Terminator.Preprocess(ctx)
+	err := mgr.callback(ctx, PhaseTerminate, mgr.Callbacks.Terminator.Preprocess)
 	if err != nil {
-		mgr.SetLifecycleState(prev)
-		return err
+		return mgr.revert(prev, PhaseTerminate, err)
+	}
+
+	// Terminate child components
+	err = mgr.terminateChildren(ctx)
+	if err != nil {
+		return mgr.revert(prev, PhaseTerminate, err)
 	}
 
 	// Run primary terminate functionality
-	err = mgr.Component.ExecuteTerminate(ctx)
+	err = mgr.execute(ctx, PhaseTerminate, mgr.Component.ExecuteTerminate)
 	if err != nil {
-		mgr.SetLifecycleState(prev)
-		return err
+		return mgr.revert(prev, PhaseTerminate, err)
 	}
 
 	// Run callbacks that follow terminate
-	err = mgr.Callbacks.Terminator.Postprocess(ctx)
+	err = mgr.callback(ctx, PhaseTerminate, mgr.Callbacks.Terminator.Postprocess)
 	if err != nil {
-		mgr.SetLifecycleState(prev)
-		return err
+		return mgr.revert(prev, PhaseTerminate, err)
 	}
 
 	mgr.SetLifecycleState(Terminated)
 	return nil
 }
+
+// Run a lifecycle callback, classifying any failure as a callback error. Errors from
+// components driven by the callback itself are passed through as-is.
+func (mgr *LifecycleManager) callback(ctx context.Context, phase LifecyclePhase, step func(context.Context) error) error {
+	err := mgr.invoke(ctx, phase, step, nil)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*LifecycleError); ok {
+		return err
+	}
+	var cfgerr *ConfigurationError
+	if errors.As(err, &cfgerr) {
+		return err
+	}
+	return &CallbackError{Component: mgr.Name, Phase: phase, Err: err}
+}
+
+// Run primary component functionality for a phase. Failures not already classified by
+// the component are treated as infrastructure errors.
+func (mgr *LifecycleManager) execute(ctx context.Context, phase LifecyclePhase, step func(context.Context) error) error {
+	err := mgr.awaitAbandoned(ctx, phase)
+	if err == nil {
+		err = mgr.invoke(ctx, phase, step, mgr.undo(phase))
+	}
+	if err == nil {
+		return nil
+	}
+	var cfgerr *ConfigurationError
+	var cberr *CallbackError
+	var infraerr *InfrastructureError
+	if errors.As(err, &cfgerr) || errors.As(err, &cberr) || errors.As(err, &infraerr) {
+		return err
+	}
+	return &InfrastructureError{Component: mgr.Name, Err: err}
+}
+
+// Get the component functionality that reverses the primary functionality of a phase.
+func (mgr *LifecycleManager) undo(phase LifecyclePhase) func(context.Context) error {
+	switch phase {
+	case PhaseInitialize:
+		return mgr.Component.ExecuteTerminate
+	case PhaseStart:
+		return mgr.Component.ExecuteStop
+	case PhasePause:
+		return mgr.executeResume
+	case PhaseResume:
+		return mgr.executePause
+	}
+	return nil
+}
+
+// Build a lifecycle error for a failure in the given phase.
+func (mgr *LifecycleManager) failure(phase LifecyclePhase, err error) *LifecycleError {
+	lerr := newLifecycleError(mgr.Name, phase)
+	lerr.addFailure(mgr.Name, err)
+	return lerr
+}
+
+// Return to a previous state after a failure in the given phase.
+func (mgr *LifecycleManager) revert(state LifecycleState, phase LifecyclePhase, err error) error {
+	lerr := mgr.failure(phase, err)
+	mgr.setLifecycleState(state, lerr)
+	return lerr
+}
+
+// Initialize children that have not yet been initialized or were terminated.
+func (mgr *LifecycleManager) initializeChildren(ctx context.Context) error {
+	return mgr.processChildren(ctx, PhaseInitialize, func(child LifecycleComponent) error {
+		state := child.Lifecycle().State()
+		if state != Uninitialized && state != Terminated {
+			return nil
+		}
+		return child.Initialize(ctx)
+	})
+}
+
+// Start children that are initialized or stopped.
+func (mgr *LifecycleManager) startChildren(ctx context.Context) error {
+	return mgr.processChildren(ctx, PhaseStart, func(child LifecycleComponent) error {
+		state := child.Lifecycle().State()
+		if state != Initialized && state != Stopped {
+			return nil
+		}
+		return child.Start(ctx)
+	})
+}
+
+// Stop children that are started or paused.
+func (mgr *LifecycleManager) stopChildren(ctx context.Context) error {
+	return mgr.processChildren(ctx, PhaseStop, func(child LifecycleComponent) error {
+		state := child.Lifecycle().State()
+		if state != Started && state != Paused {
+			return nil
+		}
+		return child.Stop(ctx)
+	})
+}
+
+// Terminate children that are stopped or were initialized but never started.
+func (mgr *LifecycleManager) terminateChildren(ctx context.Context) error {
+	return mgr.processChildren(ctx, PhaseTerminate, func(child LifecycleComponent) error {
+		state := child.Lifecycle().State()
+		if state != Stopped && state != Initialized {
+			return nil
+		}
+		return child.Terminate(ctx)
+	})
+}
+
+// Run an operation against children one dependency layer at a time. Initialize/start/resume
+// process layers in dependency order and stop after the first layer in which an operation
+// fails. Stop/terminate/pause process layers in reverse order and continue past failures so
+// that as many children as possible are shut down. Children within a layer are processed
+// concurrently. Failures of all children are reported together.
+func (mgr *LifecycleManager) processChildren(ctx context.Context, phase LifecyclePhase, operation func(LifecycleComponent) error) error {
+	layers, err := mgr.dependencyLayers()
+	if err != nil {
+		return err
+	}
+	reverse := phase == PhaseStop || phase == PhaseTerminate || phase == PhasePause
+
+	lerr := newLifecycleError(mgr.Name, phase)
+	for i := range layers {
+		layer := layers[i]
+		if reverse {
+			layer = layers[len(layers)-1-i]
+		}
+
+		errs := make([]error, len(layer))
+		var wg sync.WaitGroup
+		for idx, child := range layer {
+			wg.Add(1)
+			go func(idx int, child LifecycleComponent) {
+				defer wg.Done()
+				errs[idx] = operation(child)
+			}(idx, child)
+		}
+		wg.Wait()
+
+		for idx, err := range errs {
+			lerr.addFailure(layer[idx].Lifecycle().Name, err)
+		}
+		if lerr.hasFailures() && !reverse {
+			break
+		}
+	}
+	if lerr.hasFailures() {
+		return lerr
+	}
+	return nil
+}
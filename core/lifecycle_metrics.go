@@ -0,0 +1,88 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Prometheus metrics recorded during lifecycle processing.
+type LifecycleMetrics struct {
+	State     *prometheus.GaugeVec
+	Durations *prometheus.HistogramVec
+	Failures  *prometheus.CounterVec
+	Restarts  *prometheus.CounterVec
+}
+
+// Create lifecycle metrics registered for the given microservice.
+func NewLifecycleMetrics(ms *Microservice) *LifecycleMetrics {
+	return &LifecycleMetrics{
+		State: ms.NewGaugeVec("lifecycle_state",
+			"Current lifecycle state of component (see LifecycleState)", []string{"component"}),
+		Durations: ms.NewHistogramVec("lifecycle_phase_duration_seconds",
+			"Time taken to complete lifecycle phases", []float64{.01, .05, .1, .5, 1, 2.5, 5, 10, 30, 60, 120},
+			[]string{"component", "phase"}),
+		Failures: ms.NewCounterVec("lifecycle_failures_total",
+			"Count of failed lifecycle phases", []string{"component", "phase"}),
+		Restarts: ms.NewCounterVec("lifecycle_restarts_total",
+			"Count of retries of failed lifecycle phases", []string{"component", "phase"}),
+	}
+}
+
+// Wrap a lifecycle phase so that its duration and any failure are recorded. Calls rejected
+// because of an invalid state transition are not recorded.
+func (mgr *LifecycleManager) measured(phase LifecyclePhase, run func(context.Context) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		started := time.Now()
+		err := run(ctx)
+
+		metrics := mgr.Metrics()
+		if metrics == nil {
+			return err
+		}
+		if err == nil {
+			metrics.Durations.WithLabelValues(mgr.Name, string(phase)).Observe(time.Since(started).Seconds())
+		} else if _, ok := err.(*LifecycleError); ok {
+			metrics.Durations.WithLabelValues(mgr.Name, string(phase)).Observe(time.Since(started).Seconds())
+			metrics.Failures.WithLabelValues(mgr.Name, string(phase)).Inc()
+		}
+		return err
+	}
+}
+
+// Set metrics recorded for this component and any children that do not set their own.
+func (mgr *LifecycleManager) SetMetrics(metrics *LifecycleMetrics) {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	mgr.metrics = metrics
+}
+
+// Get metrics recorded for this component (inherited from ancestors if not set).
+func (mgr *LifecycleManager) Metrics() *LifecycleMetrics {
+	mgr.mutex.RLock()
+	metrics := mgr.metrics
+	parent := mgr.parent
+	mgr.mutex.RUnlock()
+
+	if metrics == nil && parent != nil {
+		return parent.Metrics()
+	}
+	return metrics
+}
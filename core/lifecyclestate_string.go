@@ -17,11 +17,14 @@ func _() {
 	_ = x[Stopped-6]
 	_ = x[Terminating-7]
 	_ = x[Terminated-8]
+	_ = x[Pausing-9]
+	_ = x[Paused-10]
+	_ = x[Resuming-11]
 }
 
-const _LifecycleState_name = "UninitializedInitializingInitializedStartingStartedStoppingStoppedTerminatingTerminated"
+const _LifecycleState_name = "UninitializedInitializingInitializedStartingStartedStoppingStoppedTerminatingTerminatedPausingPausedResuming"
 
-var _LifecycleState_index = [...]uint8{0, 13, 25, 36, 44, 51, 59, 66, 77, 87}
+var _LifecycleState_index = [...]uint8{0, 13, 25, 36, 44, 51, 59, 66, 77, 87, 94, 100, 108}
 
 func (i LifecycleState) String() string {
 	if i < 0 || i >= LifecycleState(len(_LifecycleState_index)-1) {
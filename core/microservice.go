@@ -20,10 +20,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -58,13 +60,44 @@ type Microservice struct {
 	InstanceConfiguration        config.InstanceConfiguration
 	MicroserviceConfigurationRaw []byte
 
+	// Configuration file locations (from flags or environment). In dev mode, defaults are
+	// used in place of configuration files that do not exist.
+	InstanceConfigurationFile     string
+	MicroserviceConfigurationFile string
+	DevMode                       bool
+
 	// Common microservice tooling
-	Redis *RedisManager
+	Redis         *RedisManager
+	Health        *HealthServer
+	ConfigWatcher *ConfigurationWatcher
+
+	// Time to wait for traffic to drain and hard limit for graceful shutdown
+	ShutdownDrainPeriod time.Duration
+	ShutdownTimeout     time.Duration
+
+	// Configuration change processing
+	configuration        sync.RWMutex
+	reloading            sync.Mutex
+	validators           []ConfigurationValidator
+	configurationTarget  interface{}
+	configurationCurrent interface{}
+	secrets              []string
+	instanceLoaded       bool
+	microserviceLoaded   bool
+	instanceHandlers     []InstanceConfigurationHandler
+	microserviceHandlers []MicroserviceConfigurationHandler
 
 	// Internal lifeycle processing
-	lifecycle LifecycleManager
-	shutdown  chan os.Signal
-	done      chan bool
+	lifecycle     *LifecycleManager
+	sequence      sync.Mutex
+	startup       context.Context
+	cancelStartup context.CancelFunc
+	shutdown      chan os.Signal
+	reload        chan os.Signal
+	done          chan error
+	work          sync.Mutex
+	inflight      int
+	draining      bool
 }
 
 // Create a new microservice instance
@@ -80,24 +113,55 @@ func NewMicroservice(callbacks LifecycleCallbacks) *Microservice {
 	ms.MicroserviceName = os.Getenv(ENV_MICROSERVICE_NAME)
 	ms.FunctionalArea = os.Getenv(ENV_MS_FUNCTIONAL_AREA)
 
-	// Create common tooling.
-	ms.Redis = NewRedisManager(ms, NewNoOpLifecycleCallbacks())
+	// Resolve configuration locations from command line and environment.
+	flags := ParseFlags(os.Args[1:])
+	ms.InstanceConfigurationFile = stringSetting(flags.InstanceConfig, ENV_INSTANCE_CONFIG_PATH, DEFAULT_INSTANCE_CONFIG_PATH)
+	ms.MicroserviceConfigurationFile = stringSetting(flags.MicroserviceConfig, ENV_MICROSERVICE_CONFIG_PATH, "")
+	ms.DevMode = boolSetting(flags.DevMode, ENV_DEV_MODE)
+	if ms.DevMode {
+		log.Warn().Msg("Running in dev mode. Default configuration is used for missing configuration files.")
+	}
+
+	ms.ShutdownDrainPeriod = DEFAULT_SHUTDOWN_DRAIN_PERIOD
+	if period := durationFromEnv(ENV_SHUTDOWN_DRAIN_PERIOD); period > 0 {
+		ms.ShutdownDrainPeriod = period
+	}
+	ms.ShutdownTimeout = DEFAULT_SHUTDOWN_TIMEOUT
+	if timeout := durationFromEnv(ENV_SHUTDOWN_TIMEOUT); timeout > 0 {
+		ms.ShutdownTimeout = timeout
+	}
 
 	// Create lifecycle manager and channels for tracking shutdown.
 	ms.lifecycle = NewLifecycleManager(ms.FunctionalArea, ms, callbacks)
-	ms.done = make(chan bool, 1)
+	ms.lifecycle.SetTimeouts(LifecycleTimeouts{
+		Initialize: durationFromEnv(ENV_INITIALIZE_TIMEOUT),
+		Start:      durationFromEnv(ENV_START_TIMEOUT),
+		Stop:       durationFromEnv(ENV_STOP_TIMEOUT),
+		Terminate:  durationFromEnv(ENV_TERMINATE_TIMEOUT),
+	})
+	ms.lifecycle.SetMetrics(NewLifecycleMetrics(ms))
+	ms.done = make(chan error, 1)
+	ms.startup, ms.cancelStartup = context.WithCancel(context.Background())
 	ms.shutdown = make(chan os.Signal, 1)
+	ms.reload = make(chan os.Signal, 1)
+
+	// Create common tooling.
+	ms.Health = NewHealthServer(ms)
+	ms.Health.Port = portSetting(flags.HealthPort, ENV_HEALTH_PORT, HEALTH_PORT)
+	ms.Redis = NewRedisManager(ms, NewNoOpLifecycleCallbacks())
+	ms.AddComponent(ms.Redis)
+	ms.ConfigWatcher = NewConfigurationWatcher(ms)
+	ms.AddComponent(ms.ConfigWatcher)
 
 	// Hook interrupt and terminate signals for graceful shutdown
 	signal.Notify(ms.shutdown, syscall.SIGINT, syscall.SIGTERM)
 
 	// Async handle shutdown on signals
-	go func() {
-		sig := <-ms.shutdown
-		fmt.Println()
-		log.Warn().Msgf("Received signal '%v'. Shutting down gracefully...", sig)
-		ms.ShutDownNow()
-	}()
+	go ms.handleSignals()
+
+	// Hook hangup signal for configuration reload
+	signal.Notify(ms.reload, syscall.SIGHUP)
+	go ms.handleReloadSignals()
 
 	return ms
 }
@@ -126,33 +190,63 @@ func (ms *Microservice) Banner() {
 	fmt.Println()
 }
 
-// Create microservice and initialize/start it.
+// Create microservice and initialize/start it. Blocks until the microservice shuts down
+// and returns the error that caused startup or shutdown to fail (if any). Use ExitCode to
+// map the result to a process exit code.
 func (ms *Microservice) Run() error {
 	log.Info().Msg("Creating new microservice and running intialization/startup...")
 
+	ms.Health.Start()
 	go func() {
 		ms.Banner()
 		err := ms.InitializeAndStart()
 		if err != nil {
-			ms.done <- true
+			ms.done <- err
 		}
 	}()
 
-	ms.waitForShutdown()
-	return nil
+	result := ms.waitForShutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := ms.Health.Stop(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to stop health server")
+	}
+	return result
 }
 
-// Issue initialize and start commands to microservice
+// Issue initialize and start commands to microservice. A shutdown requested while
+// startup is in progress cancels startup (including any retries) and waits for it to
+// return. Startup cancelled by a shutdown is not reported as an error.
 func (ms *Microservice) InitializeAndStart() error {
+	ms.sequence.Lock()
+	defer ms.sequence.Unlock()
+
 	startedat := time.Now()
-	err := ms.Initialize(context.Background())
+	err := ms.Initialize(ms.startup)
+	if err != nil && ms.startup.Err() != nil {
+		log.Warn().Err(err).Msg("Initialization cancelled by shutdown")
+		return nil
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("Unable to initialize microservice")
 		return err
 	}
-	err = ms.Start(context.Background())
+	err = ms.Start(ms.startup)
 	if err != nil {
-		log.Error().Err(err).Msg("Unable to start microservice")
+		if ms.startup.Err() != nil {
+			log.Warn().Err(err).Msg("Startup cancelled by shutdown")
+			err = nil
+		} else {
+			log.Error().Err(err).Msg("Unable to start microservice")
+		}
+
+		// Release resources held by initialized components.
+		terr := ms.Terminate(context.Background())
+		if terr != nil {
+			log.Error().Err(terr).Msg("Unable to terminate microservice after failed startup")
+		}
 		return err
 	}
 	elapsed := time.Since(startedat)
@@ -160,22 +254,82 @@ func (ms *Microservice) InitializeAndStart() error {
 	return nil
 }
 
-// Issue stop and terminate commands to microservice
+// Issue stop and terminate commands to microservice. Startup in progress is cancelled.
 func (ms *Microservice) ShutDownNow() {
+	ms.cancelStartup()
+	ms.sequence.Lock()
+	defer ms.sequence.Unlock()
+
+	// Nothing to stop if startup failed or was cancelled.
+	if state := ms.lifecycle.State(); state == Uninitialized || state == Terminated {
+		ms.done <- nil
+		return
+	}
+
 	err := ms.Stop(context.Background())
 	if err != nil {
 		log.Error().Err(err).Msg("Unable to stop microservice")
-		ms.done <- true
+		ms.done <- err
 		return
 	}
 	err = ms.Terminate(context.Background())
 	if err != nil {
 		log.Error().Err(err).Msg("Unable to terminate microservice")
-		ms.done <- true
+		ms.done <- err
 		return
 	}
 
-	ms.done <- true
+	ms.done <- nil
+}
+
+// Add a component whose lifecycle is managed along with the microservice. Components are
+// initialized/started after the microservice and after any components they depend on. They
+// are stopped/terminated in reverse order before the microservice. Dependencies must be
+// added before the components that depend on them.
+func (ms *Microservice) AddComponent(component LifecycleComponent, dependencies ...LifecycleComponent) error {
+	return ms.lifecycle.AddChild(component, dependencies...)
+}
+
+// Add a health check reported by the health endpoints. The name should match the
+// lifecycle name of the component being checked.
+func (ms *Microservice) AddHealthCheck(name string, check HealthCheck) {
+	ms.Health.AddCheck(name, check)
+}
+
+// Set timeouts for microservice lifecycle phases. Components inherit any timeouts
+// they do not set themselves.
+func (ms *Microservice) SetLifecycleTimeouts(timeouts LifecycleTimeouts) {
+	ms.lifecycle.SetTimeouts(timeouts)
+}
+
+// Set policy for retrying failed microservice initialization/startup. Failed attempts are
+// rolled back before retrying.
+func (ms *Microservice) SetRestartPolicy(policy RestartPolicy) {
+	ms.lifecycle.SetRestartPolicy(policy)
+}
+
+// Pause the microservice and all of its components for a maintenance window. While paused,
+// components halt background processing but remain able to serve reads.
+func (ms *Microservice) Pause(ctx context.Context) error {
+	log.Info().Msg("Pausing microservice for maintenance.")
+	return ms.lifecycle.Pause(ctx)
+}
+
+// Resume a microservice that was paused for maintenance.
+func (ms *Microservice) Resume(ctx context.Context) error {
+	log.Info().Msg("Resuming microservice after maintenance.")
+	return ms.lifecycle.Resume(ctx)
+}
+
+// Indicates whether the microservice is paused (or pausing/resuming) for maintenance.
+func (ms *Microservice) Paused() bool {
+	return ms.lifecycle.Paused()
+}
+
+// Block background work while the microservice is paused. Returns immediately if the
+// microservice is not paused.
+func (ms *Microservice) AwaitResume(ctx context.Context) error {
+	return ms.lifecycle.AwaitResume(ctx)
 }
 
 // Use Redis to get a lock across all microservice replicas.
@@ -195,47 +349,195 @@ func (ms *Microservice) WithDistributedLock(ctx context.Context, duration time.D
 	return logic(ctx)
 }
 
-// Wait for microservice to shut down
-func (ms *Microservice) waitForShutdown() {
-	<-ms.done
+// Wait for microservice to shut down and return the error that caused it (if any).
+func (ms *Microservice) waitForShutdown() error {
+	return <-ms.done
+}
+
+// Get path of instance configuration (by default in configmap volume mapping)
+func (ms *Microservice) InstanceConfigurationPath() string {
+	if ms.InstanceConfigurationFile == "" {
+		return DEFAULT_INSTANCE_CONFIG_PATH
+	}
+	return ms.InstanceConfigurationFile
+}
+
+// Get path of microservice configuration (by default in configmap volume mapping)
+func (ms *Microservice) MicroserviceConfigurationPath() (string, error) {
+	if ms.MicroserviceConfigurationFile != "" {
+		return ms.MicroserviceConfigurationFile, nil
+	}
+	fa, found := os.LookupEnv(ENV_MS_FUNCTIONAL_AREA)
+	if !found {
+		return "", fmt.Errorf("environment variable for functional area (%s) not set", ENV_MS_FUNCTIONAL_AREA)
+	}
+	return fmt.Sprintf("%s/%s", DEFAULT_MICROSERVICE_CONFIG_DIR, fa), nil
 }
 
 // Reloads instance configuration from configmap volume mapping
 func (ms *Microservice) ReloadInstanceConfiguration() error {
-	bytes, err := os.ReadFile("/etc/dci-config/instance")
+	config, err := ms.readInstanceConfiguration()
 	if err != nil {
 		return err
 	}
-	config := &config.InstanceConfiguration{}
-	err = json.Unmarshal(bytes, config)
+	ms.applyInstanceConfiguration(*config)
+	return nil
+}
+
+// Read instance configuration (json or yaml) without applying it. In dev mode, the default instance
+// configuration is used if the file does not exist. Secret references are resolved and environment
+// variable overrides are applied (see config.ApplyEnvironmentOverrides) before the merged result is
+// validated against the instance configuration schema (see config.InstanceConfigurationSchema).
+func (ms *Microservice) readInstanceConfiguration() (*config.InstanceConfiguration, error) {
+	icfg := &config.InstanceConfiguration{}
+	bytes, err := os.ReadFile(ms.InstanceConfigurationPath())
+	if err != nil && ms.DevMode && os.IsNotExist(err) {
+		log.Warn().Str("path", ms.InstanceConfigurationPath()).Msg("Instance configuration not found. Using defaults (dev mode).")
+		icfg = config.NewDefaultInstanceConfiguration()
+	} else if err != nil {
+		return nil, err
+	} else {
+		bytes, err = config.ToJSON(bytes)
+		if err != nil {
+			return nil, err
+		}
+		bytes, err = ms.resolveSecrets(bytes)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(bytes, icfg)
+		if err != nil {
+			// Report type errors as schema violations where possible.
+			if verr := config.ValidateJSON(config.InstanceConfigurationSchema(), bytes); verr != nil {
+				return nil, verr
+			}
+			return nil, err
+		}
+	}
+
+	overrides, err := config.ApplyEnvironmentOverrides(icfg, config.ENV_OVERRIDE_PREFIX)
+	if err != nil {
+		return nil, err
+	}
+	if len(overrides) > 0 {
+		log.Info().Strs("variables", overrides).Msg("Applied environment overrides to instance configuration.")
+	}
+
+	// Validate the configuration with overrides applied.
+	merged, err := json.Marshal(icfg)
+	if err != nil {
+		return nil, err
+	}
+	err = config.ValidateJSON(config.InstanceConfigurationSchema(), merged)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	ms.InstanceConfiguration = *config
-	return nil
+	return icfg, nil
 }
 
 // Reloads microservice configuration from configmap volume mapping
 func (ms *Microservice) ReloadMicroserviceConfiguration() error {
-	fa, found := os.LookupEnv(ENV_MS_FUNCTIONAL_AREA)
-	if !found {
-		return fmt.Errorf("environment variable for functional area (%s) not set", ENV_MS_FUNCTIONAL_AREA)
-	}
-
-	// Read config from filesystem.
-	cfgbytes, err := os.ReadFile(fmt.Sprintf("/etc/dct-config/%s", fa))
+	cfgbytes, err := ms.readMicroserviceConfiguration()
 	if err != nil {
 		return err
 	}
-	ms.MicroserviceConfigurationRaw = cfgbytes
 
-	// Print configuration to log as json.
+	// Print configuration to log as json (with secrets redacted).
 	var fmted bytes.Buffer
-	json.Indent(&fmted, ms.MicroserviceConfigurationRaw, "", "  ")
+	json.Indent(&fmted, ms.Redact(cfgbytes), "", "  ")
 	log.Info().Msg(fmt.Sprintf("Using configuration:\n\n%s\n", fmted.String()))
+
+	return ms.applyMicroserviceConfiguration(cfgbytes)
+}
+
+// Unmarshal microservice configuration into a caller-provided struct pointer. Fields not
+// present in the configuration are set from their 'default' tags, then the result is
+// validated against 'validate' tags (see config.Validate). All violations are reported
+// together in a single configuration error.
+func (ms *Microservice) LoadMicroserviceConfiguration(target interface{}) error {
+	return decodeMicroserviceConfiguration(ms.GetMicroserviceConfigurationRaw(), target)
+}
+
+// Bind a struct pointer that microservice configuration is loaded into as part of
+// initialization. Initialization fails if the configuration is not valid. Reloaded
+// configuration is validated against the same rules. The bound struct is not modified by
+// reloads; use GetMicroserviceConfiguration to get the configuration currently in effect.
+func (ms *Microservice) BindMicroserviceConfiguration(target interface{}) {
+	ms.configuration.Lock()
+	defer ms.configuration.Unlock()
+	ms.configurationTarget = target
+	ms.configurationCurrent = nil
+}
+
+// Decode raw microservice configuration into a struct, applying defaults and validation.
+func decodeMicroserviceConfiguration(raw []byte, target interface{}) error {
+	err := config.ApplyDefaults(target)
+	if err != nil {
+		return &ConfigurationError{Err: err}
+	}
+	err = json.Unmarshal(raw, target)
+	if err != nil {
+		return &ConfigurationError{Err: err}
+	}
+	err = config.Validate(target)
+	if err != nil {
+		return &ConfigurationError{Err: err}
+	}
 	return nil
 }
 
+// Read microservice configuration without applying it. Yaml content is converted to json. In
+// dev mode, empty configuration is used if the file can not be located. Secret references
+// are resolved.
+func (ms *Microservice) readMicroserviceConfiguration() ([]byte, error) {
+	path, err := ms.MicroserviceConfigurationPath()
+	if err == nil {
+		var cfgbytes []byte
+		cfgbytes, err = os.ReadFile(path)
+		if err == nil {
+			cfgbytes, err = config.ToJSON(cfgbytes)
+			if err != nil {
+				return nil, err
+			}
+			return ms.resolveSecrets(cfgbytes)
+		}
+	}
+	if ms.DevMode && (path == "" || os.IsNotExist(err)) {
+		log.Warn().Str("path", path).Msg("Microservice configuration not found. Using empty configuration (dev mode).")
+		return []byte("{}"), nil
+	}
+	return nil, err
+}
+
+// Resolve secret references in configuration content, keeping track of the secret
+// values so that they can be redacted.
+func (ms *Microservice) resolveSecrets(content []byte) ([]byte, error) {
+	resolved, secrets, err := config.ResolveSecretsJSON(content)
+	if err != nil {
+		return nil, err
+	}
+	ms.configuration.Lock()
+	defer ms.configuration.Unlock()
+	for _, secret := range secrets {
+		known := false
+		for _, existing := range ms.secrets {
+			known = known || existing == secret
+		}
+		if !known {
+			ms.secrets = append(ms.secrets, secret)
+		}
+	}
+	return resolved, nil
+}
+
+// Redact json configuration content so that it can be logged safely. Values of sensitive
+// keys (such as passwords) and values resolved from secret references are replaced.
+func (ms *Microservice) Redact(content []byte) []byte {
+	ms.configuration.RLock()
+	defer ms.configuration.RUnlock()
+	return config.RedactJSON(content, ms.secrets)
+}
+
 // Create a new counter with the namespace and subsystem auto-filled based on microservice
 func (ms *Microservice) NewCounter(name string, help string, labels []string) prometheus.Counter {
 	return promauto.NewCounter(prometheus.CounterOpts{
@@ -276,6 +578,33 @@ func (ms *Microservice) NewGaugeVec(name string, help string, labels []string) *
 	}, labels)
 }
 
+// Create a new histogram with the namespace and subsystem auto-filled based on microservice
+func (ms *Microservice) NewHistogram(name string, help string, buckets []float64) prometheus.Histogram {
+	return promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: METRICS_NAMESPACE,
+		Subsystem: strings.ReplaceAll(ms.FunctionalArea, "-", ""),
+		Name:      name,
+		Help:      help,
+		Buckets:   buckets,
+	})
+}
+
+// Create a new histogram vector with the namespace and subsystem auto-filled based on microservice
+func (ms *Microservice) NewHistogramVec(name string, help string, buckets []float64, labels []string) *prometheus.HistogramVec {
+	return promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: METRICS_NAMESPACE,
+		Subsystem: strings.ReplaceAll(ms.FunctionalArea, "-", ""),
+		Name:      name,
+		Help:      help,
+		Buckets:   buckets,
+	}, labels)
+}
+
+// Get lifecycle manager for microservice.
+func (ms *Microservice) Lifecycle() *LifecycleManager {
+	return ms.lifecycle
+}
+
 // Initialize microservice
 func (ms *Microservice) Initialize(ctx context.Context) error {
 	return ms.lifecycle.Initialize(ctx)
@@ -286,20 +615,21 @@ func (ms *Microservice) ExecuteInitialize(ctx context.Context) error {
 	// Load instance configuration.
 	err := ms.ReloadInstanceConfiguration()
 	if err != nil {
-		return err
+		return &ConfigurationError{Err: err}
 	}
 	log.Info().Msg("Successfully loaded instance configuration.")
 
-	// Load microservice configuration.
+	// Load microservice configuration (and the bound struct if any).
 	err = ms.ReloadMicroserviceConfiguration()
 	if err != nil {
-		return err
+		var cfgerr *ConfigurationError
+		if errors.As(err, &cfgerr) {
+			return err
+		}
+		return &ConfigurationError{Err: err}
 	}
 	log.Info().Msg("Successfully loaded microservice configuration.")
-
-	// Initialize Redis connectivity.
-	err = ms.Redis.Initialize(ctx)
-	return err
+	return nil
 }
 
 // Start microservice
@@ -309,9 +639,7 @@ func (ms *Microservice) Start(ctx context.Context) error {
 
 // Start microservice (as called by lifecycle manager)
 func (ms *Microservice) ExecuteStart(ctx context.Context) error {
-	// Execute Redis startup.
-	err := ms.Redis.Start(ctx)
-	return err
+	return nil
 }
 
 // Stop microservice
@@ -321,9 +649,7 @@ func (ms *Microservice) Stop(ctx context.Context) error {
 
 // Stop microservice (as called by lifecycle manager)
 func (ms *Microservice) ExecuteStop(ctx context.Context) error {
-	// Execute Redis shutdown.
-	err := ms.Redis.Stop(ctx)
-	return err
+	return nil
 }
 
 // Terminate microservice
@@ -333,7 +659,5 @@ func (ms *Microservice) Terminate(ctx context.Context) error {
 
 // Terminate microservice (as called by lifecycle manager)
 func (ms *Microservice) ExecuteTerminate(ctx context.Context) error {
-	// Execute Redis termination.
-	err := ms.Redis.Terminate(ctx)
-	return err
+	return nil
 }
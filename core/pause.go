@@ -0,0 +1,211 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"context"
+	"errors"
+)
+
+// Optional interface for components that need to take action when paused for maintenance
+// (for instance, to halt background processing). Components that do not implement it are
+// still moved through the pause states along with their parent.
+type PausableComponent interface {
+	// Pause a started component.
+	ExecutePause(context.Context) error
+
+	// Resume a paused component.
+	ExecuteResume(context.Context) error
+}
+
+// Handle pausing a started component. Children are paused in reverse dependency order
+// before the component itself. If any step fails, children that were paused are resumed.
+func (mgr *LifecycleManager) Pause(ctx context.Context) error {
+	return mgr.measured(PhasePause, mgr.pause)(ctx)
+}
+
+// Run pause logic.
+func (mgr *LifecycleManager) pause(ctx context.Context) error {
+	mgr.operation.Lock()
+	defer mgr.operation.Unlock()
+
+	state := mgr.State()
+	if state == Paused {
+		return errors.New("attempting to pause a component that is already paused")
+	}
+	if state != Started {
+		return errors.New("attempting to pause a component that is not started")
+	}
+	mgr.holdResume()
+	mgr.SetLifecycleState(Pausing)
+
+	// Bound the time allowed for the phase
+	ctx, cancel := mgr.phaseContext(ctx, PhasePause)
+	defer cancel()
+
+	// Pause child components
+	err := mgr.pauseChildren(ctx)
+
+	// Run primary pause functionality
+	if err == nil {
+		err = mgr.execute(ctx, PhasePause, mgr.executePause)
+	}
+
+	// Resume children that were paused if a later step failed (the component itself is
+	// only paused by the last step)
+	if err != nil {
+		lerr := mgr.failure(PhasePause, err)
+		rctx, rcancel := mgr.phaseContext(context.Background(), PhaseResume)
+		if !isDependencyError(err) {
+			lerr.addRollback(mgr.Name, mgr.resumeChildren(rctx))
+		}
+		rcancel()
+		mgr.releaseResume()
+		mgr.setLifecycleState(Started, lerr)
+		return lerr
+	}
+
+	mgr.SetLifecycleState(Paused)
+	return nil
+}
+
+// Handle resuming a paused component. The component is resumed before its children, which
+// are resumed in dependency order. If any step fails, children that were resumed and the
+// component itself are paused again so that the component remains paused.
+func (mgr *LifecycleManager) Resume(ctx context.Context) error {
+	return mgr.measured(PhaseResume, mgr.resume)(ctx)
+}
+
+// Run resume logic.
+func (mgr *LifecycleManager) resume(ctx context.Context) error {
+	mgr.operation.Lock()
+	defer mgr.operation.Unlock()
+
+	if mgr.State() != Paused {
+		return errors.New("attempting to resume a component that is not paused")
+	}
+	mgr.SetLifecycleState(Resuming)
+
+	// Bound the time allowed for the phase
+	ctx, cancel := mgr.phaseContext(ctx, PhaseResume)
+	defer cancel()
+
+	// Run primary resume functionality
+	err := mgr.execute(ctx, PhaseResume, mgr.executeResume)
+	if err != nil {
+		return mgr.revert(Paused, PhaseResume, err)
+	}
+
+	// Resume child components, pausing everything that was resumed if any fail (with a
+	// new context since the phase context may have expired)
+	err = mgr.resumeChildren(ctx)
+	if err != nil {
+		lerr := mgr.failure(PhaseResume, err)
+		rctx, rcancel := mgr.phaseContext(context.Background(), PhasePause)
+		if !isDependencyError(err) {
+			lerr.addRollback(mgr.Name, mgr.pauseChildren(rctx))
+		}
+		lerr.addRollback(mgr.Name, mgr.execute(rctx, PhasePause, mgr.executePause))
+		rcancel()
+		mgr.setLifecycleState(Paused, lerr)
+		return lerr
+	}
+
+	mgr.releaseResume()
+	mgr.SetLifecycleState(Started)
+	return nil
+}
+
+// Indicates whether the component is pausing, paused or resuming.
+func (mgr *LifecycleManager) Paused() bool {
+	mgr.mutex.RLock()
+	defer mgr.mutex.RUnlock()
+	return mgr.resumed != nil
+}
+
+// Block while the component is paused. Returns immediately if the component is not paused
+// and returns an error if the context is done before the component resumes.
+func (mgr *LifecycleManager) AwaitResume(ctx context.Context) error {
+	mgr.mutex.RLock()
+	resumed := mgr.resumed
+	mgr.mutex.RUnlock()
+
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Mark component as paused so that callers of AwaitResume block.
+func (mgr *LifecycleManager) holdResume() {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	if mgr.resumed == nil {
+		mgr.resumed = make(chan struct{})
+	}
+}
+
+// Release any callers blocked in AwaitResume.
+func (mgr *LifecycleManager) releaseResume() {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	if mgr.resumed != nil {
+		close(mgr.resumed)
+		mgr.resumed = nil
+	}
+}
+
+// Invoke pause logic if the component supports it.
+func (mgr *LifecycleManager) executePause(ctx context.Context) error {
+	if pausable, ok := mgr.Component.(PausableComponent); ok {
+		return pausable.ExecutePause(ctx)
+	}
+	return nil
+}
+
+// Invoke resume logic if the component supports it.
+func (mgr *LifecycleManager) executeResume(ctx context.Context) error {
+	if pausable, ok := mgr.Component.(PausableComponent); ok {
+		return pausable.ExecuteResume(ctx)
+	}
+	return nil
+}
+
+// Pause children that are started.
+func (mgr *LifecycleManager) pauseChildren(ctx context.Context) error {
+	return mgr.processChildren(ctx, PhasePause, func(child LifecycleComponent) error {
+		if child.Lifecycle().State() != Started {
+			return nil
+		}
+		return child.Lifecycle().Pause(ctx)
+	})
+}
+
+// Resume children that are paused.
+func (mgr *LifecycleManager) resumeChildren(ctx context.Context) error {
+	return mgr.processChildren(ctx, PhaseResume, func(child LifecycleComponent) error {
+		if child.Lifecycle().State() != Paused {
+			return nil
+		}
+		return child.Lifecycle().Resume(ctx)
+	})
+}
@@ -0,0 +1,93 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (tc *testComponent) ExecutePause(ctx context.Context) error  { return tc.step(PhasePause) }
+func (tc *testComponent) ExecuteResume(ctx context.Context) error { return tc.step(PhaseResume) }
+
+func TestPauseResumeRollback(t *testing.T) {
+	names := []string{"a", "b", "c"}
+	deps := map[string][]string{"b": {"a"}, "c": {"b"}}
+	tests := []struct {
+		name   string
+		phase  LifecyclePhase
+		fails  string
+		steps  []string
+		state  LifecycleState
+		states map[string]LifecycleState
+	}{
+		{"pause child", PhasePause, "a",
+			[]string{"pause c", "pause b", "pause a", "resume b", "resume c"},
+			Started, map[string]LifecycleState{"a": Started, "b": Started, "c": Started}},
+		{"pause parent", PhasePause, "parent",
+			[]string{"pause c", "pause b", "pause a", "pause parent", "resume a", "resume b", "resume c"},
+			Started, map[string]LifecycleState{"a": Started, "b": Started, "c": Started}},
+		{"resume parent", PhaseResume, "parent",
+			[]string{"resume parent"},
+			Paused, map[string]LifecycleState{"a": Paused, "b": Paused, "c": Paused}},
+		{"resume child", PhaseResume, "b",
+			[]string{"resume parent", "resume a", "resume b", "pause a", "pause parent"},
+			Paused, map[string]LifecycleState{"a": Paused, "b": Paused, "c": Paused}},
+		{"resume last child", PhaseResume, "c",
+			[]string{"resume parent", "resume a", "resume b", "resume c", "pause b", "pause a", "pause parent"},
+			Paused, map[string]LifecycleState{"a": Paused, "b": Paused, "c": Paused}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parent, children := newTestTree(t, names, deps)
+			require.NoError(t, parent.Initialize(context.Background()))
+			require.NoError(t, parent.Start(context.Background()))
+			if test.phase == PhaseResume {
+				require.NoError(t, parent.lifecycle.Pause(context.Background()))
+			}
+			parent.steps.all = nil
+
+			failing := parent
+			if test.fails != "parent" {
+				failing = children[test.fails]
+			}
+			failing.fails = test.phase
+
+			var err error
+			if test.phase == PhasePause {
+				err = parent.lifecycle.Pause(context.Background())
+			} else {
+				err = parent.lifecycle.Resume(context.Background())
+			}
+			require.IsType(t, &LifecycleError{}, err)
+			lerr := err.(*LifecycleError)
+			require.Len(t, lerr.Failures, 1)
+			assert.Equal(t, test.fails, lerr.Failures[0].Component)
+			assert.Empty(t, lerr.Rollback)
+
+			assert.Equal(t, test.steps, parent.steps.list())
+			assert.Equal(t, test.state, parent.lifecycle.State())
+			assert.Equal(t, test.state == Paused, parent.lifecycle.Paused())
+			for name, state := range test.states {
+				assert.Equal(t, state, children[name].lifecycle.State(), name)
+			}
+		})
+	}
+}
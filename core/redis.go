@@ -18,9 +18,17 @@ package core
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/bsm/redislock"
+	"github.com/devicechain-io/dc-microservice/config"
 	redis "github.com/go-redis/redis/v8"
 	"github.com/rs/zerolog/log"
 )
@@ -28,24 +36,47 @@ import (
 // Manages lifecycle of Redis interactions.
 type RedisManager struct {
 	Microservice *Microservice
-	Client       *redis.Client
+	Client       redis.UniversalClient
 	RedisLock    *redislock.Client
 
-	lifecycle LifecycleManager
+	lifecycle    *LifecycleManager
+	metrics      *CacheMetrics
+	replica      string
+	invalidation sync.Mutex
+	caches       map[string]*RedisCache
+	subscription *redis.PubSub
+	listening    bool
 }
 
 // Create a new Redis manager.
 func NewRedisManager(ms *Microservice, callbacks LifecycleCallbacks) *RedisManager {
 	redis := &RedisManager{
 		Microservice: ms,
+		metrics:      NewCacheMetrics(ms),
+		replica:      newReplicaId(),
+		caches:       make(map[string]*RedisCache),
 	}
 
 	// Create lifecycle manager.
 	name := fmt.Sprintf("%s-%s", ms.FunctionalArea, "redis")
 	redis.lifecycle = NewLifecycleManager(name, redis, callbacks)
+	ms.AddHealthCheck(name, redis.CheckHealth)
 	return redis
 }
 
+// Verify that Redis responds to a ping.
+func (rmgr *RedisManager) CheckHealth(ctx context.Context) error {
+	if rmgr.Client == nil {
+		return errors.New("redis client is not initialized")
+	}
+	return rmgr.Client.Ping(ctx).Err()
+}
+
+// Get lifecycle manager for component.
+func (rmgr *RedisManager) Lifecycle() *LifecycleManager {
+	return rmgr.lifecycle
+}
+
 // Initialize component.
 func (rmgr *RedisManager) Initialize(ctx context.Context) error {
 	return rmgr.lifecycle.Initialize(ctx)
@@ -53,21 +84,69 @@ func (rmgr *RedisManager) Initialize(ctx context.Context) error {
 
 // Lifecycle callback that runs initialization logic.
 func (rmgr *RedisManager) ExecuteInitialize(ctx context.Context) error {
-	rconfig := rmgr.Microservice.InstanceConfiguration.Infrastructure.Redis
-	url := fmt.Sprintf("%s:%d", rconfig.Hostname, rconfig.Port)
+	rconfig := rmgr.Microservice.GetInstanceConfiguration().Infrastructure.Redis
+	tlsConfig, err := newRedisTlsConfig(rconfig.Tls)
+	if err != nil {
+		return err
+	}
 
-	rmgr.Client = redis.NewClient(&redis.Options{
-		Addr:     url,
-		Password: "",
-		DB:       0,
+	url := fmt.Sprintf("%s:%d", rconfig.Hostname, rconfig.Port)
+	options := &redis.UniversalOptions{
+		Addrs: []string{url},
 		OnConnect: func(ctx context.Context, cn *redis.Conn) error {
 			log.Info().Msg(fmt.Sprintf("Successfully connected to Redis at %s", url))
 			return nil
 		},
-	})
-	if status := rmgr.Client.Ping(ctx); status.Err() != nil {
+		Username:       rconfig.Username,
+		Password:       rconfig.Password,
+		DB:             int(rconfig.Database),
+		DialTimeout:    milliseconds(rconfig.DialTimeoutMillis),
+		ReadTimeout:    milliseconds(rconfig.ReadTimeoutMillis),
+		WriteTimeout:   milliseconds(rconfig.WriteTimeoutMillis),
+		PoolSize:       int(rconfig.PoolSize),
+		MinIdleConns:   int(rconfig.MinIdleConnections),
+		MaxConnAge:     milliseconds(rconfig.MaxConnectionAgeMillis),
+		PoolTimeout:    milliseconds(rconfig.PoolTimeoutMillis),
+		IdleTimeout:    milliseconds(rconfig.IdleTimeoutMillis),
+		TLSConfig:      tlsConfig,
+		MaxRedirects:   int(rconfig.Cluster.MaxRedirects),
+		ReadOnly:       rconfig.Cluster.ReadOnly,
+		RouteByLatency: rconfig.Cluster.RouteByLatency,
+	}
+
+	// Choose client based on deployment (cluster, sentinel or standalone).
+	var client redis.UniversalClient
+	switch {
+	case rconfig.Cluster.Enabled && rconfig.Sentinel.MasterName != "":
+		return fmt.Errorf("redis cluster and sentinel configuration can not be combined")
+	case rconfig.Cluster.Enabled:
+		if rconfig.Database != 0 {
+			return fmt.Errorf("redis cluster only supports database 0 (configured %d)", rconfig.Database)
+		}
+		if len(rconfig.Cluster.Addresses) > 0 {
+			options.Addrs = rconfig.Cluster.Addresses
+		}
+		url = fmt.Sprintf("%s (cluster)", strings.Join(options.Addrs, ","))
+		client = redis.NewClusterClient(options.Cluster())
+	case rconfig.Sentinel.MasterName != "":
+		if len(rconfig.Sentinel.Addresses) > 0 {
+			options.Addrs = rconfig.Sentinel.Addresses
+		}
+		options.MasterName = rconfig.Sentinel.MasterName
+		options.SentinelUsername = rconfig.Sentinel.Username
+		options.SentinelPassword = rconfig.Sentinel.Password
+		url = fmt.Sprintf("%s (sentinel master '%s')", strings.Join(options.Addrs, ","), rconfig.Sentinel.MasterName)
+		client = redis.NewFailoverClient(options.Failover())
+	default:
+		client = redis.NewClient(options.Simple())
+	}
+
+	// Only keep the client once it is verified so that failed attempts do not leak pools.
+	if status := client.Ping(ctx); status.Err() != nil {
+		client.Close()
 		return status.Err()
 	}
+	rmgr.Client = client
 	log.Info().Msg(fmt.Sprintf("Verified successful Redis ping against %s", url))
 
 	// Set up redis lock implementation using client.
@@ -76,13 +155,58 @@ func (rmgr *RedisManager) ExecuteInitialize(ctx context.Context) error {
 	return nil
 }
 
+// Indicates whether Redis is configured in cluster mode.
+func (rmgr *RedisManager) ClusterMode() bool {
+	return rmgr.Microservice.GetInstanceConfiguration().Infrastructure.Redis.Cluster.Enabled
+}
+
+// Build TLS configuration for Redis connections (nil if TLS is not enabled).
+func newRedisTlsConfig(tconfig config.RedisTlsConfiguration) (*tls.Config, error) {
+	if !tconfig.Enabled {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         tconfig.ServerName,
+		InsecureSkipVerify: tconfig.InsecureSkipVerify,
+	}
+	if tconfig.CaFile != "" {
+		pem, err := os.ReadFile(tconfig.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in redis CA file %s", tconfig.CaFile)
+		}
+	}
+	if tconfig.CertFile != "" || tconfig.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(tconfig.CertFile, tconfig.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Convert a setting in milliseconds to a duration. Negative values are passed through
+// as-is since the client uses them to disable timeouts.
+func milliseconds(millis int32) time.Duration {
+	if millis < 0 {
+		return time.Duration(millis)
+	}
+	return time.Duration(millis) * time.Millisecond
+}
+
 // Start component.
 func (rmgr *RedisManager) Start(ctx context.Context) error {
 	return rmgr.lifecycle.Start(ctx)
 }
 
 // Lifecycle callback that runs startup logic.
-func (rmgr *RedisManager) ExecuteStart(context.Context) error {
+func (rmgr *RedisManager) ExecuteStart(ctx context.Context) error {
+	rmgr.startInvalidations(ctx)
 	return nil
 }
 
@@ -93,7 +217,7 @@ func (rmgr *RedisManager) Stop(ctx context.Context) error {
 
 // Lifecycle callback that runs shutdown logic.
 func (rmgr *RedisManager) ExecuteStop(context.Context) error {
-	return nil
+	return rmgr.stopInvalidations()
 }
 
 // Terminate component.
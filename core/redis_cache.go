@@ -17,27 +17,56 @@
 package core
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
 	"time"
 
 	cache "github.com/go-redis/cache/v8"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
 )
 
+// Returned by a cache loader to indicate that no value exists for a key. Returned by
+// GetOrLoad for keys that are not found (including cached negative results).
+var ErrNotFound = errors.New("not found")
+
+// Value stored for negative results. Values marshaled by the cache (other than raw strings
+// and byte slices) end with a compression byte, so this can not collide with them.
+var notFoundMarker = []byte("dc:not-found\xff")
+
+// Time allowed for a shared load (including storing its result) unless set on the cache.
+var DefaultCacheLoadTimeout = 30 * time.Second
+
+// Loads the value for a cache key on a miss.
+type CacheLoader func(ctx context.Context) (interface{}, error)
+
 type RedisCache struct {
-	Manager RedisManager
+	Manager *RedisManager
 	Cache   *cache.Cache
 
-	name   string
-	prefix string
+	name        string
+	prefix      string
+	channel     string
+	ttl         time.Duration
+	negativeTtl time.Duration
+	loadTimeout time.Duration
+	local       cache.LocalCache
+	loading     singleflight.Group
+	counters    *cacheCounters
 }
 
-// Create a new cache with the given settings.
-func NewRedisCache(manager RedisManager, name string, size int, ttl time.Duration) *RedisCache {
+// Create a new cache with the given settings. In cluster mode, the key prefix is a hash tag
+// so that all keys for the cache are stored in the same slot. Changes to entries are published
+// so that other replicas evict them from their local caches.
+func NewRedisCache(manager *RedisManager, name string, size int, ttl time.Duration) *RedisCache {
 	// Create cache with options passed.
+	local := cache.NewTinyLFU(size, ttl)
 	rcache := cache.New(&cache.Options{
 		Redis:      manager.Client,
-		LocalCache: cache.NewTinyLFU(size, ttl),
+		LocalCache: local,
 	})
 
 	wrapper := &RedisCache{
@@ -45,7 +74,18 @@ func NewRedisCache(manager RedisManager, name string, size int, ttl time.Duratio
 		Cache:   rcache,
 	}
 	wrapper.name = name
-	wrapper.prefix = fmt.Sprintf("%s_%s_%s_", manager.Microservice.InstanceId, manager.Microservice.FunctionalArea, name)
+	wrapper.ttl = ttl
+	wrapper.loadTimeout = DefaultCacheLoadTimeout
+	wrapper.local = local
+	wrapper.counters = &cacheCounters{}
+	wrapper.prefix = fmt.Sprintf("%s_%s_%s", manager.Microservice.InstanceId, manager.Microservice.FunctionalArea, name)
+	if manager.ClusterMode() {
+		wrapper.prefix = fmt.Sprintf("{%s}_", wrapper.prefix)
+	} else {
+		wrapper.prefix = wrapper.prefix + "_"
+	}
+	wrapper.channel = fmt.Sprintf("%s_%s_%s_invalidations", manager.Microservice.InstanceId, manager.Microservice.FunctionalArea, name)
+	manager.registerCache(wrapper)
 	return wrapper
 }
 
@@ -58,8 +98,10 @@ func (rc *RedisCache) Set(ctx context.Context, key string, value interface{}, tt
 		TTL:   ttl,
 	})
 	if err != nil {
+		rc.failed(CACHE_OPERATION_SET)
 		return err
 	}
+	rc.invalidate(ctx, key)
 	return nil
 }
 
@@ -67,3 +109,230 @@ func (rc *RedisCache) Set(ctx context.Context, key string, value interface{}, tt
 func (rc *RedisCache) Get(ctx context.Context, key string, callback func(*cache.Cache, string)) {
 	callback(rc.Cache, rc.prefix+key)
 }
+
+// Enable caching of "not found" results from loaders for the given duration (at least
+// one second). Negative results are not held in the local cache. Zero disables caching
+// of negative results, which is the default.
+func (rc *RedisCache) SetNegativeTtl(ttl time.Duration) {
+	rc.negativeTtl = ttl
+}
+
+// Set the time allowed for a shared load started by GetOrLoad. Zero or less disables the
+// timeout, leaving the loader to honor cancellation on its own.
+func (rc *RedisCache) SetLoadTimeout(timeout time.Duration) {
+	rc.loadTimeout = timeout
+}
+
+// Get an entry from the cache, unmarshaling it into value (a pointer). On a miss, the
+// loader is called and its result is stored with the cache TTL. Concurrent misses for the
+// same key share a single call to the loader. The shared load keeps the values of the
+// context passed by the caller that started it, but not its cancellation, so that one
+// caller giving up does not fail the others. Each caller stops waiting when its own
+// context is done. Returns ErrNotFound if the loader reports that the value does not exist.
+func (rc *RedisCache) GetOrLoad(ctx context.Context, key string, value interface{}, loader CacheLoader) error {
+	pkey := rc.prefix + key
+	if cached, found := rc.local.Get(pkey); found {
+		rc.hit(true)
+		return rc.decode(pkey, cached, value)
+	}
+	var cached []byte
+	err := rc.Cache.Get(ctx, pkey, &cached)
+	if err == nil {
+		rc.hit(false)
+		return rc.decode(pkey, cached, value)
+	}
+	if err != cache.ErrCacheMiss {
+		rc.failed(CACHE_OPERATION_GET)
+		return err
+	}
+	rc.miss()
+
+	shared := rc.loading.DoChan(pkey, func() (interface{}, error) {
+		lctx, cancel := rc.loadContext(ctx)
+		defer cancel()
+		return rc.load(lctx, pkey, loader)
+	})
+	select {
+	case result := <-shared:
+		if result.Err != nil {
+			return result.Err
+		}
+		return rc.Cache.Unmarshal(result.Val.([]byte), value)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Build the context for a shared load from the context of the caller that started it.
+func (rc *RedisCache) loadContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := detachedContext{ctx}
+	if rc.loadTimeout <= 0 {
+		return context.WithCancel(detached)
+	}
+	return context.WithTimeout(detached, rc.loadTimeout)
+}
+
+// Context that keeps the values of a parent context but not its deadline or cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (dc detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (dc detachedContext) Done() <-chan struct{}             { return nil }
+func (dc detachedContext) Err() error                        { return nil }
+func (dc detachedContext) Value(key interface{}) interface{} { return dc.parent.Value(key) }
+
+// Unmarshal a cached entry into value, returning ErrNotFound for cached negative results.
+func (rc *RedisCache) decode(pkey string, cached []byte, value interface{}) error {
+	if bytes.Equal(cached, notFoundMarker) {
+		rc.Cache.DeleteFromLocalCache(pkey)
+		return ErrNotFound
+	}
+	return rc.Cache.Unmarshal(cached, value)
+}
+
+// Call the loader for a key and store the result, returning the marshaled value. Failing to
+// store the result is counted and logged but does not fail the load.
+func (rc *RedisCache) load(ctx context.Context, pkey string, loader CacheLoader) ([]byte, error) {
+	started := time.Now()
+	loaded, err := loader(ctx)
+	if errors.Is(err, ErrNotFound) {
+		rc.loaded(started, CACHE_LOAD_NOT_FOUND)
+		if rc.negativeTtl > 0 {
+			serr := rc.Cache.Set(&cache.Item{
+				Ctx:            ctx,
+				Key:            pkey,
+				Value:          notFoundMarker,
+				TTL:            rc.negativeTtl,
+				SkipLocalCache: true,
+			})
+			if serr != nil {
+				rc.failed(CACHE_OPERATION_SET)
+				log.Warn().Err(serr).Str("cache", rc.name).Msg("Unable to cache negative result.")
+			}
+		}
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		rc.loaded(started, CACHE_LOAD_ERROR)
+		rc.failed(CACHE_OPERATION_LOAD)
+		return nil, err
+	}
+	rc.loaded(started, CACHE_LOAD_SUCCESS)
+
+	marshaled, err := rc.Cache.Marshal(loaded)
+	if err != nil {
+		return nil, err
+	}
+	err = rc.Cache.Set(&cache.Item{
+		Ctx:   ctx,
+		Key:   pkey,
+		Value: marshaled,
+		TTL:   rc.ttl,
+	})
+	if err != nil {
+		rc.failed(CACHE_OPERATION_SET)
+		log.Warn().Err(err).Str("cache", rc.name).Msg("Unable to cache loaded value.")
+	}
+	return marshaled, nil
+}
+
+// Get entries for multiple keys, adding those found to values (a pointer to a map with
+// string keys). Entries are read from the local cache where possible and from Redis in
+// a single request otherwise. Returns the keys that were not found.
+func (rc *RedisCache) GetMulti(ctx context.Context, keys []string, values interface{}) ([]string, error) {
+	target := reflect.ValueOf(values)
+	if target.Kind() != reflect.Ptr || target.Elem().Kind() != reflect.Map || target.Elem().Type().Key().Kind() != reflect.String {
+		return nil, errors.New("values must be a pointer to a map with string keys")
+	}
+	entries := target.Elem()
+	if entries.IsNil() {
+		entries.Set(reflect.MakeMap(entries.Type()))
+	}
+	add := func(key string, marshaled []byte) error {
+		entry := reflect.New(entries.Type().Elem())
+		err := rc.Cache.Unmarshal(marshaled, entry.Interface())
+		if err != nil {
+			return err
+		}
+		entries.SetMapIndex(reflect.ValueOf(key).Convert(entries.Type().Key()), entry.Elem())
+		return nil
+	}
+
+	missing := make([]string, 0)
+	remote := make([]string, 0)
+	for _, key := range keys {
+		if marshaled, found := rc.local.Get(rc.prefix + key); found {
+			rc.hit(true)
+			if err := add(key, marshaled); err != nil {
+				return nil, err
+			}
+		} else {
+			remote = append(remote, key)
+		}
+	}
+	if len(remote) == 0 || rc.Manager.Client == nil {
+		for range remote {
+			rc.miss()
+		}
+		return append(missing, remote...), nil
+	}
+
+	pkeys := make([]string, len(remote))
+	for idx, key := range remote {
+		pkeys[idx] = rc.prefix + key
+	}
+	results, err := rc.Manager.Client.MGet(ctx, pkeys...).Result()
+	if err != nil {
+		rc.failed(CACHE_OPERATION_GET)
+		return nil, err
+	}
+	for idx, result := range results {
+		str, ok := result.(string)
+		if !ok || str == string(notFoundMarker) {
+			rc.miss()
+			missing = append(missing, remote[idx])
+			continue
+		}
+		rc.hit(false)
+		rc.local.Set(pkeys[idx], []byte(str))
+		if err := add(remote[idx], []byte(str)); err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// Indicates whether an entry exists for a key. Cached negative results are not entries.
+func (rc *RedisCache) Exists(ctx context.Context, key string) (bool, error) {
+	var cached []byte
+	err := rc.Cache.Get(ctx, rc.prefix+key, &cached)
+	if err == cache.ErrCacheMiss {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(cached, notFoundMarker), nil
+}
+
+// Delete an entry (or negative result) from the local cache and Redis.
+func (rc *RedisCache) Delete(ctx context.Context, key string) error {
+	err := rc.Cache.Delete(ctx, rc.prefix+key)
+	if err != nil {
+		rc.failed(CACHE_OPERATION_DELETE)
+		return err
+	}
+	rc.invalidate(ctx, key)
+	return nil
+}
+
+// Notify other replicas to evict keys from their local caches. Failures are logged rather
+// than returned since the change has already been made in Redis.
+func (rc *RedisCache) invalidate(ctx context.Context, keys ...string) {
+	err := rc.Manager.publishInvalidation(ctx, rc.channel, keys)
+	if err != nil {
+		rc.failed(CACHE_OPERATION_INVALIDATE)
+		log.Warn().Err(err).Str("cache", rc.name).Msg("Unable to publish cache invalidation.")
+	}
+}
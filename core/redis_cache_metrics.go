@@ -0,0 +1,147 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	CACHE_OPERATION_GET        = "get"
+	CACHE_OPERATION_SET        = "set"
+	CACHE_OPERATION_DELETE     = "delete"
+	CACHE_OPERATION_LOAD       = "load"
+	CACHE_OPERATION_INVALIDATE = "invalidate"
+
+	CACHE_LOAD_SUCCESS   = "success"
+	CACHE_LOAD_NOT_FOUND = "not_found"
+	CACHE_LOAD_ERROR     = "error"
+)
+
+// Prometheus metrics recorded by Redis caches.
+type CacheMetrics struct {
+	Hits          *prometheus.CounterVec
+	LocalHits     *prometheus.CounterVec
+	Misses        *prometheus.CounterVec
+	Errors        *prometheus.CounterVec
+	LoadDurations *prometheus.HistogramVec
+}
+
+// Create cache metrics registered for the given microservice.
+func NewCacheMetrics(ms *Microservice) *CacheMetrics {
+	return &CacheMetrics{
+		Hits: ms.NewCounterVec("cache_hits_total",
+			"Count of cache reads served from Redis", []string{"cache"}),
+		LocalHits: ms.NewCounterVec("cache_local_hits_total",
+			"Count of cache reads served from the local cache", []string{"cache"}),
+		Misses: ms.NewCounterVec("cache_misses_total",
+			"Count of cache reads that found no entry", []string{"cache"}),
+		Errors: ms.NewCounterVec("cache_errors_total",
+			"Count of failed cache operations", []string{"cache", "operation"}),
+		LoadDurations: ms.NewHistogramVec("cache_load_duration_seconds",
+			"Time taken to load values on cache misses", []float64{.001, .005, .01, .05, .1, .5, 1, 2.5, 5, 10},
+			[]string{"cache", "result"}),
+	}
+}
+
+// Snapshot of statistics for a cache since it was created.
+type CacheStats struct {
+	Name        string        `json:"name"`
+	Hits        uint64        `json:"hits"`
+	LocalHits   uint64        `json:"localHits"`
+	Misses      uint64        `json:"misses"`
+	Errors      uint64        `json:"errors"`
+	Loads       uint64        `json:"loads"`
+	LoadTime    time.Duration `json:"loadTime"`
+	HitRatio    float64       `json:"hitRatio"`
+	AverageLoad time.Duration `json:"averageLoad"`
+}
+
+// Counters backing cache statistics (allocated separately to keep 64-bit alignment).
+type cacheCounters struct {
+	hits      uint64
+	localHits uint64
+	misses    uint64
+	errors    uint64
+	loads     uint64
+	loadTime  uint64
+}
+
+// Get current statistics for the cache.
+func (rc *RedisCache) Stats() CacheStats {
+	stats := CacheStats{
+		Name:      rc.name,
+		Hits:      atomic.LoadUint64(&rc.counters.hits),
+		LocalHits: atomic.LoadUint64(&rc.counters.localHits),
+		Misses:    atomic.LoadUint64(&rc.counters.misses),
+		Errors:    atomic.LoadUint64(&rc.counters.errors),
+		Loads:     atomic.LoadUint64(&rc.counters.loads),
+		LoadTime:  time.Duration(atomic.LoadUint64(&rc.counters.loadTime)),
+	}
+	if reads := stats.Hits + stats.LocalHits + stats.Misses; reads > 0 {
+		stats.HitRatio = float64(stats.Hits+stats.LocalHits) / float64(reads)
+	}
+	if stats.Loads > 0 {
+		stats.AverageLoad = stats.LoadTime / time.Duration(stats.Loads)
+	}
+	return stats
+}
+
+// Record a read served from Redis or the local cache.
+func (rc *RedisCache) hit(local bool) {
+	metrics := rc.Manager.metrics
+	if local {
+		atomic.AddUint64(&rc.counters.localHits, 1)
+		if metrics != nil {
+			metrics.LocalHits.WithLabelValues(rc.name).Inc()
+		}
+		return
+	}
+	atomic.AddUint64(&rc.counters.hits, 1)
+	if metrics != nil {
+		metrics.Hits.WithLabelValues(rc.name).Inc()
+	}
+}
+
+// Record a read that found no entry.
+func (rc *RedisCache) miss() {
+	atomic.AddUint64(&rc.counters.misses, 1)
+	if metrics := rc.Manager.metrics; metrics != nil {
+		metrics.Misses.WithLabelValues(rc.name).Inc()
+	}
+}
+
+// Record a failed cache operation.
+func (rc *RedisCache) failed(operation string) {
+	atomic.AddUint64(&rc.counters.errors, 1)
+	if metrics := rc.Manager.metrics; metrics != nil {
+		metrics.Errors.WithLabelValues(rc.name, operation).Inc()
+	}
+}
+
+// Record a call to a loader along with its duration and result.
+func (rc *RedisCache) loaded(started time.Time, result string) {
+	elapsed := time.Since(started)
+	atomic.AddUint64(&rc.counters.loads, 1)
+	atomic.AddUint64(&rc.counters.loadTime, uint64(elapsed))
+	if metrics := rc.Manager.metrics; metrics != nil {
+		metrics.LoadDurations.WithLabelValues(rc.name, result).Observe(elapsed.Seconds())
+	}
+}
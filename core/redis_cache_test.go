@@ -0,0 +1,172 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cache "github.com/go-redis/cache/v8"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Redis hook that reports a miss for every read and fails every other command without
+// connecting to a server.
+type unavailableRedis struct{}
+
+func (unavailableRedis) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if cmd.Name() == "get" {
+		return ctx, redis.Nil
+	}
+	return ctx, errors.New("redis unavailable")
+}
+
+func (unavailableRedis) AfterProcess(ctx context.Context, cmd redis.Cmder) error { return nil }
+
+func (unavailableRedis) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, errors.New("redis unavailable")
+}
+
+func (unavailableRedis) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+// Create a cache with a local cache in front of a Redis client for which every write fails.
+func newTestCache() *RedisCache {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:0"})
+	client.AddHook(unavailableRedis{})
+	local := cache.NewTinyLFU(100, time.Minute)
+	return &RedisCache{
+		Manager:     &RedisManager{},
+		Cache:       cache.New(&cache.Options{Redis: client, LocalCache: local}),
+		name:        "test",
+		prefix:      "test_",
+		ttl:         time.Minute,
+		loadTimeout: DefaultCacheLoadTimeout,
+		local:       local,
+		counters:    &cacheCounters{},
+	}
+}
+
+func TestGetOrLoadSharesConcurrentLoads(t *testing.T) {
+	rc := newTestCache()
+	var calls int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "value", nil
+	}
+
+	const callers = 20
+	values := make([]string, callers)
+	errs := make([]error, callers)
+	var wg sync.WaitGroup
+	for idx := 0; idx < callers; idx++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			errs[idx] = rc.GetOrLoad(context.Background(), "key", &values[idx], loader)
+		}(idx)
+	}
+
+	// Callers arriving after the load completes are served from the local cache.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for idx := 0; idx < callers; idx++ {
+		assert.NoError(t, errs[idx])
+		assert.Equal(t, "value", values[idx])
+	}
+	assert.Equal(t, uint64(1), rc.Stats().Loads)
+}
+
+func TestGetOrLoadWaiterCancellation(t *testing.T) {
+	rc := newTestCache()
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-release:
+			return "value", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// The caller that starts the load gives up, but the load continues for others.
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		var value string
+		first <- rc.GetOrLoad(ctx, "key", &value, loader)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	second := make(chan error, 1)
+	var value string
+	go func() {
+		second <- rc.GetOrLoad(context.Background(), "key", &value, loader)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-first, context.Canceled)
+	close(release)
+	assert.NoError(t, <-second)
+	assert.Equal(t, "value", value)
+}
+
+func TestGetOrLoadResults(t *testing.T) {
+	failure := errors.New("unavailable")
+	tests := []struct {
+		name        string
+		negativeTtl time.Duration
+		loaded      interface{}
+		err         error
+		expected    error
+		errors      uint64
+	}{
+		{"loaded value with failed cache write", 0, "value", nil, nil, 1},
+		{"not found", 0, nil, ErrNotFound, ErrNotFound, 0},
+		{"not found with failed negative cache write", time.Minute, nil, ErrNotFound, ErrNotFound, 1},
+		{"loader error", 0, nil, failure, failure, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rc := newTestCache()
+			rc.SetNegativeTtl(test.negativeTtl)
+			var value string
+			err := rc.GetOrLoad(context.Background(), "key", &value, func(ctx context.Context) (interface{}, error) {
+				return test.loaded, test.err
+			})
+			if test.expected == nil {
+				require.NoError(t, err)
+				assert.Equal(t, test.loaded, value)
+			} else {
+				assert.ErrorIs(t, err, test.expected)
+			}
+			assert.Equal(t, test.errors, rc.Stats().Errors)
+		})
+	}
+}
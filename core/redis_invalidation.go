@@ -0,0 +1,133 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+
+	redis "github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// Message published to other replicas when cache entries are changed so that they evict
+// the entries from their local caches.
+type CacheInvalidation struct {
+	Origin string   `json:"origin"`
+	Keys   []string `json:"keys"`
+}
+
+// Generate an id that distinguishes this replica from others sharing caches.
+func newReplicaId() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		log.Warn().Err(err).Msg("Unable to generate replica id for cache invalidation.")
+	}
+	return hex.EncodeToString(id)
+}
+
+// Register a cache to receive invalidations published by other replicas.
+func (rmgr *RedisManager) registerCache(rc *RedisCache) {
+	rmgr.invalidation.Lock()
+	defer rmgr.invalidation.Unlock()
+	rmgr.caches[rc.channel] = rc
+	if rmgr.listening {
+		rmgr.subscribe(context.Background(), rc.channel)
+	}
+}
+
+// Start receiving invalidations for all registered caches.
+func (rmgr *RedisManager) startInvalidations(ctx context.Context) {
+	rmgr.invalidation.Lock()
+	defer rmgr.invalidation.Unlock()
+	rmgr.listening = true
+	for channel := range rmgr.caches {
+		rmgr.subscribe(ctx, channel)
+	}
+}
+
+// Stop receiving invalidations.
+func (rmgr *RedisManager) stopInvalidations() error {
+	rmgr.invalidation.Lock()
+	defer rmgr.invalidation.Unlock()
+	rmgr.listening = false
+	if rmgr.subscription == nil {
+		return nil
+	}
+	err := rmgr.subscription.Close()
+	rmgr.subscription = nil
+	return err
+}
+
+// Subscribe to an invalidation channel, creating the subscription on first use. Must be
+// called with the invalidation lock held.
+func (rmgr *RedisManager) subscribe(ctx context.Context, channel string) {
+	if rmgr.subscription == nil {
+		rmgr.subscription = rmgr.Client.Subscribe(ctx, channel)
+		go rmgr.receiveInvalidations(rmgr.subscription)
+		return
+	}
+	err := rmgr.subscription.Subscribe(ctx, channel)
+	if err != nil {
+		log.Error().Err(err).Str("channel", channel).Msg("Unable to subscribe to cache invalidations.")
+	}
+}
+
+// Receive invalidations until the subscription is closed.
+func (rmgr *RedisManager) receiveInvalidations(subscription *redis.PubSub) {
+	for msg := range subscription.Channel() {
+		rmgr.handleInvalidation(msg)
+	}
+}
+
+// Evict entries named in an invalidation from the local cache it applies to. Invalidations
+// published by this replica are ignored.
+func (rmgr *RedisManager) handleInvalidation(msg *redis.Message) {
+	invalidation := &CacheInvalidation{}
+	err := json.Unmarshal([]byte(msg.Payload), invalidation)
+	if err != nil {
+		log.Warn().Err(err).Str("channel", msg.Channel).Msg("Ignoring invalid cache invalidation.")
+		return
+	}
+	if invalidation.Origin == rmgr.replica {
+		return
+	}
+
+	rmgr.invalidation.Lock()
+	rc := rmgr.caches[msg.Channel]
+	rmgr.invalidation.Unlock()
+	if rc == nil {
+		return
+	}
+	for _, key := range invalidation.Keys {
+		rc.Cache.DeleteFromLocalCache(rc.prefix + key)
+	}
+}
+
+// Publish an invalidation for keys in a cache.
+func (rmgr *RedisManager) publishInvalidation(ctx context.Context, channel string, keys []string) error {
+	if rmgr.Client == nil {
+		return nil
+	}
+	payload, err := json.Marshal(&CacheInvalidation{Origin: rmgr.replica, Keys: keys})
+	if err != nil {
+		return err
+	}
+	return rmgr.Client.Publish(ctx, channel, payload).Err()
+}
@@ -0,0 +1,103 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+
+	"github.com/devicechain-io/dc-microservice/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Function that verifies reloaded configuration before it is applied.
+type ConfigurationValidator func(instance config.InstanceConfiguration, microservice []byte) error
+
+// Register a validator run against reloaded configuration before it is applied.
+func (ms *Microservice) AddConfigurationValidator(validator ConfigurationValidator) {
+	ms.configuration.Lock()
+	defer ms.configuration.Unlock()
+	ms.validators = append(ms.validators, validator)
+}
+
+// Validate configuration with the built-in checks and all registered validators.
+func (ms *Microservice) validateConfiguration(instance config.InstanceConfiguration, microservice []byte) error {
+	if !json.Valid(microservice) {
+		return errors.New("microservice configuration is not valid json")
+	}
+
+	ms.configuration.RLock()
+	validators := append([]ConfigurationValidator{}, ms.validators...)
+	target := ms.configurationTarget
+	ms.configuration.RUnlock()
+
+	// Verify microservice configuration can be loaded into a new instance of the bound struct.
+	if target != nil {
+		err := decodeMicroserviceConfiguration(microservice, reflect.New(reflect.TypeOf(target).Elem()).Interface())
+		if err != nil {
+			return err
+		}
+	}
+	for _, validator := range validators {
+		err := validator(instance, microservice)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reload instance and microservice configuration together. Both are read and validated
+// before either is applied, so if anything fails the current configuration is kept.
+// Change handlers are notified for configuration that was updated.
+func (ms *Microservice) ReloadConfiguration() error {
+	ms.reloading.Lock()
+	defer ms.reloading.Unlock()
+
+	instance, err := ms.readInstanceConfiguration()
+	if err != nil {
+		return &ConfigurationError{Err: err}
+	}
+	microservice, err := ms.readMicroserviceConfiguration()
+	if err != nil {
+		return &ConfigurationError{Err: err}
+	}
+	err = ms.validateConfiguration(*instance, microservice)
+	if err != nil {
+		return &ConfigurationError{Err: err}
+	}
+
+	ms.applyInstanceConfiguration(*instance)
+	err = ms.applyMicroserviceConfiguration(microservice)
+	if err != nil {
+		return err
+	}
+	log.Info().Msg("Successfully reloaded configuration.")
+	return nil
+}
+
+// Handle hangup signals by reloading configuration.
+func (ms *Microservice) handleReloadSignals() {
+	for sig := range ms.reload {
+		log.Info().Msgf("Received signal '%v'. Reloading configuration...", sig)
+		err := ms.ReloadConfiguration()
+		if err != nil {
+			log.Error().Err(err).Msg("Unable to reload configuration. Keeping previous configuration.")
+		}
+	}
+}
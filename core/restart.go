@@ -0,0 +1,121 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Policy for retrying failed initialization/startup of a component. Delays between
+// attempts grow exponentially from the initial backoff up to the maximum backoff and are
+// randomized by the jitter fraction (e.g. 0.2 for +/- 20%). A policy with fewer than two
+// attempts disables retries.
+type RestartPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+}
+
+// Create a restart policy with exponential backoff and reasonable defaults.
+func NewExponentialRestartPolicy(maxAttempts int) RestartPolicy {
+	return RestartPolicy{
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2.0,
+		Jitter:         0.2,
+	}
+}
+
+// Compute delay before the given retry (first retry is attempt 1).
+func (rp RestartPolicy) backoff(attempt int) time.Duration {
+	multiplier := rp.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(rp.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if rp.MaxBackoff > 0 && delay > float64(rp.MaxBackoff) {
+		delay = float64(rp.MaxBackoff)
+	}
+	if rp.Jitter > 0 {
+		delay = delay * (1 + rp.Jitter*(2*rand.Float64()-1))
+	}
+	return time.Duration(delay)
+}
+
+// Set policy for retrying failed initialization/startup of this component.
+func (mgr *LifecycleManager) SetRestartPolicy(policy RestartPolicy) {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	mgr.restarts = policy
+}
+
+// Run a lifecycle phase, retrying component failures based on the restart policy. Errors
+// caused by invalid state transitions, invalid configuration or unresolvable dependencies,
+// or by the caller cancelling the context are not retried.
+func (mgr *LifecycleManager) withRestarts(ctx context.Context, phase LifecyclePhase,
+	attempt func(context.Context) error) error {
+	mgr.mutex.RLock()
+	policy := mgr.restarts
+	mgr.mutex.RUnlock()
+
+	err := attempt(ctx)
+	for retry := 1; retry < policy.MaxAttempts; retry++ {
+		if lerr, ok := err.(*LifecycleError); !ok || !lerr.retryable() || ctx.Err() != nil {
+			return err
+		}
+
+		delay := policy.backoff(retry)
+		log.Warn().Err(err).Str("component", mgr.Name).Str("phase", string(phase)).Int("attempt", retry+1).
+			Int("max_attempts", policy.MaxAttempts).Dur("backoff", delay).Msg("Lifecycle phase failed. Retrying.")
+		if metrics := mgr.Metrics(); metrics != nil {
+			metrics.Restarts.WithLabelValues(mgr.Name, string(phase)).Inc()
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		err = attempt(ctx)
+	}
+	return err
+}
+
+// Indicates whether retrying could fix the failures of a lifecycle phase. Invalid
+// configuration and unresolvable dependencies fail the same way on every attempt.
+func (lerr *LifecycleError) retryable() bool {
+	for _, failure := range lerr.Failures {
+		var cfgerr *ConfigurationError
+		var derr *DependencyError
+		if errors.As(failure.Err, &cfgerr) || errors.As(failure.Err, &derr) {
+			return false
+		}
+	}
+	return true
+}
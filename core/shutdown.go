@@ -0,0 +1,114 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DEFAULT_SHUTDOWN_DRAIN_PERIOD = 5 * time.Second
+	DEFAULT_SHUTDOWN_TIMEOUT      = 90 * time.Second
+)
+
+// Handle shutdown signals. The first signal starts a graceful shutdown and a second
+// signal forces the process to exit immediately.
+func (ms *Microservice) handleSignals() {
+	sig := <-ms.shutdown
+	fmt.Println()
+	log.Warn().Msgf("Received signal '%v'. Shutting down gracefully...", sig)
+
+	go func() {
+		sig := <-ms.shutdown
+		log.Error().Msgf("Received second signal '%v'. Exiting immediately.", sig)
+		os.Exit(EXIT_CODE_FORCED_SHUTDOWN)
+	}()
+
+	ms.GracefulShutdown()
+}
+
+// Shut down the microservice in two stages. Startup in progress is cancelled. During the drain period the microservice
+// reports that it is not ready (so that no new traffic is routed to it) while in-flight
+// work completes. The microservice is then stopped and terminated. If shutdown does not
+// complete before the shutdown timeout, the process exits immediately.
+func (ms *Microservice) GracefulShutdown() {
+	deadline := time.AfterFunc(ms.ShutdownTimeout, func() {
+		log.Error().Dur("timeout", ms.ShutdownTimeout).Msg("Graceful shutdown did not complete in time. Exiting immediately.")
+		os.Exit(EXIT_CODE_FORCED_SHUTDOWN)
+	})
+	defer deadline.Stop()
+
+	ms.cancelStartup()
+	ms.drain()
+	ms.ShutDownNow()
+}
+
+// Indicates whether the microservice is draining in preparation for shutdown.
+func (ms *Microservice) Draining() bool {
+	ms.work.Lock()
+	defer ms.work.Unlock()
+	return ms.draining
+}
+
+// Mark the start of in-flight work (such as a request or message being processed) that
+// shutdown should wait for. The returned function must be called when the work completes.
+func (ms *Microservice) BeginWork() func() {
+	ms.work.Lock()
+	ms.inflight++
+	ms.work.Unlock()
+
+	completed := false
+	return func() {
+		ms.work.Lock()
+		defer ms.work.Unlock()
+		if !completed {
+			completed = true
+			ms.inflight--
+		}
+	}
+}
+
+// Get the number of units of in-flight work.
+func (ms *Microservice) InFlight() int {
+	ms.work.Lock()
+	defer ms.work.Unlock()
+	return ms.inflight
+}
+
+// Flag microservice as draining, wait for the drain period to pass, then wait for any
+// remaining in-flight work to complete.
+func (ms *Microservice) drain() {
+	ms.work.Lock()
+	ms.draining = true
+	ms.work.Unlock()
+
+	log.Info().Dur("period", ms.ShutdownDrainPeriod).Msg("Draining microservice before shutdown.")
+	time.Sleep(ms.ShutdownDrainPeriod)
+
+	if ms.InFlight() > 0 {
+		log.Info().Int("inflight", ms.InFlight()).Msg("Waiting for in-flight work to complete.")
+	}
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for ms.InFlight() > 0 {
+		<-ticker.C
+	}
+}
@@ -0,0 +1,207 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum time allowed for each lifecycle phase. Zero values inherit the timeout
+// from the parent component or from DefaultLifecycleTimeouts for top-level components.
+type LifecycleTimeouts struct {
+	Initialize time.Duration
+	Start      time.Duration
+	Stop       time.Duration
+	Terminate  time.Duration
+	Pause      time.Duration
+	Resume     time.Duration
+}
+
+// Timeouts used when neither a component nor any of its ancestors set one. A negative
+// value disables the timeout for a phase.
+var DefaultLifecycleTimeouts = LifecycleTimeouts{
+	Initialize: 2 * time.Minute,
+	Start:      time.Minute,
+	Stop:       30 * time.Second,
+	Terminate:  30 * time.Second,
+	Pause:      30 * time.Second,
+	Resume:     30 * time.Second,
+}
+
+// Get timeout for a given phase.
+func (lt LifecycleTimeouts) forPhase(phase LifecyclePhase) time.Duration {
+	switch phase {
+	case PhaseInitialize:
+		return lt.Initialize
+	case PhaseStart:
+		return lt.Start
+	case PhaseStop:
+		return lt.Stop
+	case PhaseTerminate:
+		return lt.Terminate
+	case PhasePause:
+		return lt.Pause
+	case PhaseResume:
+		return lt.Resume
+	}
+	return 0
+}
+
+// Error returned when a component does not complete a lifecycle phase in time.
+type LifecycleTimeoutError struct {
+	Component string
+	Phase     LifecyclePhase
+	Timeout   time.Duration
+}
+
+func (lte *LifecycleTimeoutError) Error() string {
+	return fmt.Sprintf("component '%s' did not %s within %s", lte.Component, lte.Phase, lte.Timeout.String())
+}
+
+// Set timeouts for lifecycle phases of this component. Children inherit any values
+// they do not set themselves.
+func (mgr *LifecycleManager) SetTimeouts(timeouts LifecycleTimeouts) {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	mgr.timeouts = timeouts
+}
+
+// Resolve the timeout for a phase based on component, ancestors and defaults.
+func (mgr *LifecycleManager) Timeout(phase LifecyclePhase) time.Duration {
+	mgr.mutex.RLock()
+	timeout := mgr.timeouts.forPhase(phase)
+	parent := mgr.parent
+	mgr.mutex.RUnlock()
+
+	if timeout != 0 {
+		return timeout
+	}
+	if parent != nil {
+		return parent.Timeout(phase)
+	}
+	return DefaultLifecycleTimeouts.forPhase(phase)
+}
+
+// Create a context that expires when the timeout for a phase elapses.
+func (mgr *LifecycleManager) phaseContext(ctx context.Context, phase LifecyclePhase) (context.Context, context.CancelFunc) {
+	timeout := mgr.Timeout(phase)
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Invoke a step of a lifecycle phase, returning a timeout error if the context deadline
+// passes before the step completes. Steps that ignore the context are left to finish in
+// the background so that a hung call can not block the lifecycle indefinitely. Since the
+// component has already been reverted when an abandoned step finishes, its work is undone
+// if an undo step is given.
+func (mgr *LifecycleManager) invoke(ctx context.Context, phase LifecyclePhase, step func(context.Context) error,
+	undo func(context.Context) error) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- step(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		mgr.abandon(phase, result, undo)
+		if ctx.Err() == context.DeadlineExceeded {
+			return &LifecycleTimeoutError{Component: mgr.Name, Phase: phase, Timeout: mgr.Timeout(phase)}
+		}
+		return ctx.Err()
+	}
+}
+
+// Track a step that was abandoned after a timeout. When it finishes, any work it completed
+// is undone before later steps are allowed to run.
+func (mgr *LifecycleManager) abandon(phase LifecyclePhase, result chan error, undo func(context.Context) error) {
+	done := make(chan struct{})
+	mgr.mutex.Lock()
+	mgr.abandoned = done
+	mgr.mutex.Unlock()
+
+	go func() {
+		defer func() {
+			mgr.mutex.Lock()
+			if mgr.abandoned == done {
+				mgr.abandoned = nil
+			}
+			mgr.mutex.Unlock()
+			close(done)
+		}()
+
+		err := <-result
+		if err != nil || undo == nil {
+			log.Warn().Err(err).Str("component", mgr.Name).Str("phase", string(phase)).
+				Msg("Abandoned lifecycle step finished after timeout.")
+			return
+		}
+		log.Warn().Str("component", mgr.Name).Str("phase", string(phase)).
+			Msg("Abandoned lifecycle step completed after timeout. Undoing its work.")
+		uctx, cancel := mgr.phaseContext(context.Background(), undoPhase(phase))
+		defer cancel()
+		if err := undo(uctx); err != nil {
+			log.Error().Err(err).Str("component", mgr.Name).Str("phase", string(phase)).
+				Msg("Unable to undo abandoned lifecycle step.")
+		}
+	}()
+}
+
+// Wait for an abandoned step (and undoing its work) to finish so that primary component
+// functionality never runs concurrently with a step left over from an earlier timeout.
+func (mgr *LifecycleManager) awaitAbandoned(ctx context.Context, phase LifecyclePhase) error {
+	mgr.mutex.RLock()
+	abandoned := mgr.abandoned
+	mgr.mutex.RUnlock()
+	if abandoned == nil {
+		return nil
+	}
+
+	log.Info().Str("component", mgr.Name).Str("phase", string(phase)).
+		Msg("Waiting for abandoned lifecycle step to finish.")
+	select {
+	case <-abandoned:
+		return nil
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return &LifecycleTimeoutError{Component: mgr.Name, Phase: phase, Timeout: mgr.Timeout(phase)}
+		}
+		return ctx.Err()
+	}
+}
+
+// Get the phase that reverses the work of a phase.
+func undoPhase(phase LifecyclePhase) LifecyclePhase {
+	switch phase {
+	case PhaseInitialize:
+		return PhaseTerminate
+	case PhaseStart:
+		return PhaseStop
+	case PhasePause:
+		return PhaseResume
+	case PhaseResume:
+		return PhasePause
+	}
+	return phase
+}
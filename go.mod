@@ -16,6 +16,8 @@ require (
 	github.com/rs/zerolog v1.26.1
 	github.com/segmentio/kafka-go v0.4.31
 	github.com/stretchr/testify v1.7.1
+	golang.org/x/sync v0.0.0-20220513210516-0976fa681c29
+	gopkg.in/yaml.v3 v3.0.0
 	gorm.io/driver/postgres v1.3.6
 	gorm.io/gorm v1.23.5
 )
@@ -30,8 +32,6 @@ require (
 	github.com/vmihailenco/msgpack/v5 v5.3.5 // indirect
 	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 	golang.org/x/exp v0.0.0-20220518171630-0b5c67f07fdf // indirect
-	golang.org/x/sync v0.0.0-20220513210516-0976fa681c29 // indirect
-	gopkg.in/yaml.v3 v3.0.0 // indirect
 	gorm.io/driver/mysql v1.3.3 // indirect
 )
 
@@ -39,7 +39,7 @@ type GraphQLManager struct {
 	Server           *http.Server
 	ContextProviders map[ContextKey]interface{}
 
-	lifecycle core.LifecycleManager
+	lifecycle *core.LifecycleManager
 }
 
 // Create a new rdb manager.
@@ -56,6 +56,11 @@ func NewGraphQLManager(ms *core.Microservice, callbacks core.LifecycleCallbacks,
 	return gql
 }
 
+// Get lifecycle manager for component.
+func (gql *GraphQLManager) Lifecycle() *core.LifecycleManager {
+	return gql.lifecycle
+}
+
 // Initialize component.
 func (gql *GraphQLManager) Initialize(ctx context.Context) error {
 	return gql.lifecycle.Initialize(ctx)
@@ -80,18 +85,22 @@ func (gql *GraphQLManager) ExecuteStart(context.Context) error {
 		panic(err)
 	}
 
+	// Handlers are registered on a new mux each time so that the server can be restarted.
+	mux := http.NewServeMux()
+
 	// Add handler for queries
-	http.Handle("/graphql", NewHttpHandler(&gql.Schema, gql.ContextProviders))
-	http.Handle("/graphiql", graphiqlHandler)
+	mux.Handle("/graphql", gql.trackWork(gql.rejectMutations(NewHttpHandler(&gql.Schema, gql.ContextProviders))))
+	mux.Handle("/graphiql", graphiqlHandler)
 
 	// Add handler for metrics
-	http.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/metrics", promhttp.Handler())
 
 	// Start server in a background thread in order to continue server startup.
+	server := &http.Server{Addr: fmt.Sprintf(":%d", GRAPHQL_PORT), Handler: mux}
+	gql.Server = server
 	go func() {
-		gql.Server = &http.Server{Addr: fmt.Sprintf(":%d", GRAPHQL_PORT)}
 		log.Info().Int32("port", GRAPHQL_PORT).Msg("Starting GraphQL server.")
-		if err := gql.Server.ListenAndServe(); err != http.ErrServerClosed {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
 			log.Error().Err(err).Msg("Error starting GraphQL server.")
 		}
 	}()
@@ -99,14 +108,26 @@ func (gql *GraphQLManager) ExecuteStart(context.Context) error {
 	return nil
 }
 
+// Track requests as in-flight work so that shutdown waits for them to complete.
+func (gql *GraphQLManager) trackWork(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		done := gql.Microservice.BeginWork()
+		defer done()
+		handler.ServeHTTP(w, r)
+	})
+}
+
 // Stop component.
 func (gql *GraphQLManager) Stop(ctx context.Context) error {
 	return gql.lifecycle.Stop(ctx)
 }
 
 // Lifecycle callback that runs shutdown logic.
-func (gql *GraphQLManager) ExecuteStop(context.Context) error {
-	err := gql.Server.Shutdown(context.Background())
+func (gql *GraphQLManager) ExecuteStop(ctx context.Context) error {
+	if gql.Server == nil {
+		return nil
+	}
+	err := gql.Server.Shutdown(ctx)
 	if err != nil {
 		return err
 	}
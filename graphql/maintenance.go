@@ -0,0 +1,215 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	OPERATION_QUERY        = "query"
+	OPERATION_MUTATION     = "mutation"
+	OPERATION_SUBSCRIPTION = "subscription"
+
+	MAINTENANCE_ERROR_CODE = "MAINTENANCE"
+)
+
+// Reject mutations while the GraphQL manager is paused for maintenance. Queries continue
+// to be served.
+func (gql *GraphQLManager) rejectMutations(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !gql.lifecycle.Paused() {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		// Read the request and restore the body for the wrapped handler.
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		var params struct {
+			Query         string `json:"query"`
+			OperationName string `json:"operationName"`
+		}
+		if err := json.Unmarshal(body, &params); err == nil &&
+			operationType(params.Query, params.OperationName) == OPERATION_MUTATION {
+			log.Warn().Str("operation", params.OperationName).Msg("Rejected GraphQL mutation during maintenance.")
+			writeMaintenanceError(w)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Write a GraphQL error response indicating that the service is in maintenance.
+func writeMaintenanceError(w http.ResponseWriter) {
+	response := &graphql.Response{
+		Errors: []*errors.QueryError{{
+			Message:    "service is paused for maintenance and is not accepting changes",
+			Extensions: map[string]interface{}{"code": MAINTENANCE_ERROR_CODE},
+		}},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", "60")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to write maintenance response.")
+	}
+}
+
+// Operation declared in a GraphQL document.
+type operation struct {
+	kind string
+	name string
+}
+
+// Determine the type of operation that will be executed for a GraphQL document based on
+// the requested operation name. This is a lightweight scan of top-level definitions rather
+// than a full parse, so an empty string is returned if the operation can not be determined
+// (in which case the executor reports the problem).
+func operationType(document string, operationName string) string {
+	operations := scanOperations(document)
+	if operationName == "" {
+		if len(operations) == 1 {
+			return operations[0].kind
+		}
+		return ""
+	}
+	for _, op := range operations {
+		if op.name == operationName {
+			return op.kind
+		}
+	}
+	return ""
+}
+
+// Scan top-level operation definitions in a GraphQL document. Fragment definitions,
+// selection sets, arguments, strings and comments are skipped.
+func scanOperations(document string) []operation {
+	operations := make([]operation, 0)
+	var current *operation
+	fragment := false
+	expectName := false
+	braces, parens := 0, 0
+
+	for i := 0; i < len(document); i++ {
+		c := document[i]
+		switch {
+		case c == '#':
+			for i < len(document) && document[i] != '\n' && document[i] != '\r' {
+				i++
+			}
+		case c == '"':
+			i = skipString(document, i)
+		case c == '{':
+			if braces == 0 && parens == 0 {
+				if current == nil && !fragment {
+					// Shorthand query with no operation keyword.
+					operations = append(operations, operation{kind: OPERATION_QUERY})
+				} else if current != nil {
+					operations = append(operations, *current)
+				}
+				current = nil
+				fragment = false
+				expectName = false
+			}
+			braces++
+		case c == '}':
+			braces--
+		case c == '(':
+			parens++
+			expectName = false
+		case c == ')':
+			parens--
+		case c == '@' || c == '$':
+			expectName = false
+			i = skipName(document, i+1) - 1
+		case isNameStart(c):
+			end := skipName(document, i)
+			name := document[i:end]
+			i = end - 1
+			if braces != 0 || parens != 0 {
+				continue
+			}
+			if current == nil && !fragment {
+				switch name {
+				case OPERATION_QUERY, OPERATION_MUTATION, OPERATION_SUBSCRIPTION:
+					current = &operation{kind: name}
+					expectName = true
+				case "fragment":
+					fragment = true
+				}
+			} else if current != nil && expectName {
+				current.name = name
+				expectName = false
+			}
+		}
+	}
+	return operations
+}
+
+// Get index of the final quote of a string or block string starting at the given index.
+func skipString(document string, start int) int {
+	if len(document) >= start+3 && document[start:start+3] == `"""` {
+		for i := start + 3; i < len(document); i++ {
+			if document[i] == '\\' && len(document) >= i+4 && document[i+1:i+4] == `"""` {
+				i += 3
+				continue
+			}
+			if len(document) >= i+3 && document[i:i+3] == `"""` {
+				return i + 2
+			}
+		}
+		return len(document)
+	}
+	for i := start + 1; i < len(document); i++ {
+		if document[i] == '\\' {
+			i++
+			continue
+		}
+		if document[i] == '"' || document[i] == '\n' {
+			return i
+		}
+	}
+	return len(document)
+}
+
+// Get index following the name starting at the given index.
+func skipName(document string, start int) int {
+	i := start
+	for i < len(document) && (isNameStart(document[i]) || (document[i] >= '0' && document[i] <= '9')) {
+		i++
+	}
+	return i
+}
+
+// Indicates whether a character may start a GraphQL name.
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,87 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanOperations(t *testing.T) {
+	tests := []struct {
+		name       string
+		document   string
+		operations []operation
+	}{
+		{"empty", ``, []operation{}},
+		{"shorthand query", `{ devices { token } }`, []operation{{kind: OPERATION_QUERY}}},
+		{"named query", `query ListDevices { devices { token } }`,
+			[]operation{{kind: OPERATION_QUERY, name: "ListDevices"}}},
+		{"anonymous mutation", `mutation { createDevice { id } }`, []operation{{kind: OPERATION_MUTATION}}},
+		{"named subscription", `subscription Events { events { id } }`,
+			[]operation{{kind: OPERATION_SUBSCRIPTION, name: "Events"}}},
+		{"variables and directives", `mutation Create($token: String = "query", $n: Int) @audit(level: 1) { create(token: $token) { id } }`,
+			[]operation{{kind: OPERATION_MUTATION, name: "Create"}}},
+		{"anonymous with variables", `mutation ($token: ID!) { delete(token: $token) }`,
+			[]operation{{kind: OPERATION_MUTATION}}},
+		{"directive without name", `query @cached { devices { token } }`, []operation{{kind: OPERATION_QUERY}}},
+		{"multiple operations", `query A { a } mutation B { b } subscription C { c }`,
+			[]operation{{kind: OPERATION_QUERY, name: "A"}, {kind: OPERATION_MUTATION, name: "B"},
+				{kind: OPERATION_SUBSCRIPTION, name: "C"}}},
+		{"fragment definitions", `fragment F on Device { mutation query } query Q { ...F } fragment G on Area { id }`,
+			[]operation{{kind: OPERATION_QUERY, name: "Q"}}},
+		{"keywords as fields", `query Q { mutation { subscription } query }`,
+			[]operation{{kind: OPERATION_QUERY, name: "Q"}}},
+		{"comments", "# mutation M { a }\nquery Q { # }\n a }",
+			[]operation{{kind: OPERATION_QUERY, name: "Q"}}},
+		{"strings with braces", `query Q { a(s: "} mutation M {", t: "\"}") } mutation N { b }`,
+			[]operation{{kind: OPERATION_QUERY, name: "Q"}, {kind: OPERATION_MUTATION, name: "N"}}},
+		{"block strings", `query Q { a(s: """ } \""" mutation M { """) } mutation N { b }`,
+			[]operation{{kind: OPERATION_QUERY, name: "Q"}, {kind: OPERATION_MUTATION, name: "N"}}},
+		{"unterminated string", `query Q { a(s: "mutation M { b }`, []operation{{kind: OPERATION_QUERY, name: "Q"}}},
+		{"names with digits", `mutation _Create2 { a }`, []operation{{kind: OPERATION_MUTATION, name: "_Create2"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.operations, scanOperations(test.document))
+		})
+	}
+}
+
+func TestOperationType(t *testing.T) {
+	document := `query List { devices { token } } mutation Create { create { id } }`
+	tests := []struct {
+		name          string
+		document      string
+		operationName string
+		kind          string
+	}{
+		{"single operation", `mutation { a }`, "", OPERATION_MUTATION},
+		{"single operation with name", `mutation M { a }`, "M", OPERATION_MUTATION},
+		{"select query", document, "List", OPERATION_QUERY},
+		{"select mutation", document, "Create", OPERATION_MUTATION},
+		{"ambiguous", document, "", ""},
+		{"unknown name", document, "Delete", ""},
+		{"no operations", `fragment F on Device { id }`, "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.kind, operationType(test.document, test.operationName))
+		})
+	}
+}
@@ -0,0 +1,160 @@
+/**
+ * Copyright © 2022 DeviceChain
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/devicechain-io/dc-microservice/core"
+	"github.com/rs/zerolog/log"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+const (
+	LIFECYCLE_EVENTS_TOPIC = "lifecycle-events"
+
+	// Maximum number of events held while no writer is available
+	LIFECYCLE_EVENTS_BUFFER_SIZE = 1000
+
+	// Maximum time allowed for flushing events once the microservice is terminated
+	LIFECYCLE_EVENTS_FLUSH_TIMEOUT = 5 * time.Second
+)
+
+// Lifecycle state transition as published to kafka.
+type LifecycleEventMessage struct {
+	InstanceId     string    `json:"instanceId"`
+	TenantId       string    `json:"tenantId"`
+	MicroserviceId string    `json:"microserviceId"`
+	FunctionalArea string    `json:"functionalArea"`
+	Component      string    `json:"component"`
+	PreviousState  string    `json:"previousState"`
+	State          string    `json:"state"`
+	Error          string    `json:"error,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// Publishes microservice lifecycle events to a scoped kafka topic. Events that occur while
+// no writer is available (before kafka is started) are buffered and sent once a writer
+// becomes available. The writer is kept open while kafka is stopped and terminated so that
+// the final transitions of the microservice are sent. It is flushed and closed once the
+// microservice is terminated.
+type lifecycleEventPublisher struct {
+	kmgr         *KafkaManager
+	microservice string
+	writer       KafkaWriter
+	pending      []kafka.Message
+	mutex        sync.Mutex
+}
+
+// Create a publisher for lifecycle events of the microservice and its components.
+func newLifecycleEventPublisher(kmgr *KafkaManager) *lifecycleEventPublisher {
+	return &lifecycleEventPublisher{
+		kmgr:         kmgr,
+		microservice: kmgr.Microservice.Lifecycle().Name,
+		pending:      make([]kafka.Message, 0),
+	}
+}
+
+// Build a kafka message for a lifecycle event.
+func (pub *lifecycleEventPublisher) toMessage(event core.LifecycleEvent) (kafka.Message, error) {
+	ms := pub.kmgr.Microservice
+	msg := &LifecycleEventMessage{
+		InstanceId:     ms.InstanceId,
+		TenantId:       ms.TenantId,
+		MicroserviceId: ms.MicroserviceId,
+		FunctionalArea: ms.FunctionalArea,
+		Component:      event.Component,
+		PreviousState:  event.Previous.String(),
+		State:          event.State.String(),
+		Timestamp:      event.Timestamp,
+	}
+	if event.Error != nil {
+		msg.Error = event.Error.Error()
+	}
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	return kafka.Message{Key: []byte(ms.MicroserviceId), Value: bytes, Time: event.Timestamp}, nil
+}
+
+// Handle a lifecycle event by sending it or buffering it until a writer is available.
+func (pub *lifecycleEventPublisher) publish(event core.LifecycleEvent) {
+	msg, err := pub.toMessage(event)
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to marshal lifecycle event.")
+		return
+	}
+
+	pub.mutex.Lock()
+	defer pub.mutex.Unlock()
+	if pub.writer == nil {
+		if len(pub.pending) >= LIFECYCLE_EVENTS_BUFFER_SIZE {
+			pub.pending = pub.pending[1:]
+		}
+		pub.pending = append(pub.pending, msg)
+		return
+	}
+	pub.writer.HandleResponse(pub.writer.WriteMessages(context.Background(), msg))
+	if event.Component == pub.microservice && event.State == core.Terminated {
+		pub.close()
+	}
+}
+
+// Indicates whether a writer is attached.
+func (pub *lifecycleEventPublisher) attached() bool {
+	pub.mutex.Lock()
+	defer pub.mutex.Unlock()
+	return pub.writer != nil
+}
+
+// Start sending events with the given writer, including any that were buffered.
+func (pub *lifecycleEventPublisher) attach(writer KafkaWriter) {
+	pub.mutex.Lock()
+	defer pub.mutex.Unlock()
+	pub.writer = writer
+	if len(pub.pending) > 0 {
+		pub.writer.HandleResponse(pub.writer.WriteMessages(context.Background(), pub.pending...))
+		pub.pending = make([]kafka.Message, 0)
+	}
+}
+
+// Flush events that have been written and close the writer, waiting at most the flush
+// timeout. Expects the caller to hold the publisher lock.
+func (pub *lifecycleEventPublisher) close() {
+	closer, ok := pub.writer.(io.Closer)
+	pub.writer = nil
+	if !ok {
+		return
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- closer.Close()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			log.Error().Err(err).Msg("Error closing lifecycle events writer.")
+		}
+	case <-time.After(LIFECYCLE_EVENTS_FLUSH_TIMEOUT):
+		log.Warn().Dur("timeout", LIFECYCLE_EVENTS_FLUSH_TIMEOUT).Msg("Timed out flushing lifecycle events.")
+	}
+}
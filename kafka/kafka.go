@@ -19,8 +19,10 @@ package kafka
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/devicechain-io/dc-microservice/core"
@@ -47,7 +49,8 @@ type KafkaManager struct {
 	oncreate  func(*KafkaManager) error
 	readers   []KafkaReader
 	writers   []KafkaWriter
-	lifecycle core.LifecycleManager
+	events    *lifecycleEventPublisher
+	lifecycle *core.LifecycleManager
 }
 
 // Create a new kafka manager.
@@ -64,12 +67,26 @@ func NewKafkaManager(ms *core.Microservice, callbacks core.LifecycleCallbacks,
 	// Create lifecycle manager.
 	kfkaname := fmt.Sprintf("%s-%s", ms.FunctionalArea, "kafka")
 	kmgr.lifecycle = core.NewLifecycleManager(kfkaname, kmgr, callbacks)
+	ms.AddHealthCheck(kfkaname, kmgr.CheckHealth)
+
+	// Publish lifecycle events for the microservice and all of its components.
+	kmgr.events = newLifecycleEventPublisher(kmgr)
+	ms.Lifecycle().Subscribe(kmgr.events.publish)
 	return kmgr
 }
 
+// Verify that a connection can be established to the kafka brokers.
+func (kmgr *KafkaManager) CheckHealth(ctx context.Context) error {
+	conn, err := kafka.DialContext(ctx, "tcp", kmgr.KafkaBrokersUrl())
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
 // Get the kafka brokers url.
 func (kmgr *KafkaManager) KafkaBrokersUrl() string {
-	cfg := kmgr.Microservice.InstanceConfiguration.Infrastructure.Kafka
+	cfg := kmgr.Microservice.GetInstanceConfiguration().Infrastructure.Kafka
 	return fmt.Sprintf("%s:%d", cfg.Hostname, cfg.Port)
 }
 
@@ -86,7 +103,7 @@ func (kmgr *KafkaManager) NewScopedConsumerGroup(topic string) string {
 
 // Create a topic if it doesn't already exist.
 func (kmgr *KafkaManager) ValidateTopic(topic string) error {
-	cfg := kmgr.Microservice.InstanceConfiguration.Infrastructure.Kafka
+	cfg := kmgr.Microservice.GetInstanceConfiguration().Infrastructure.Kafka
 	conn, err := kafka.Dial("tcp", kmgr.KafkaBrokersUrl())
 	if err != nil {
 		return err
@@ -116,8 +133,114 @@ func (kmgr *KafkaManager) ValidateTopic(topic string) error {
 }
 
 // Wraps kafka reader to add new functionality.
+// Messages returned by FetchMessage are tracked as in-flight microservice work (see
+// core.Microservice.BeginWork) until they are committed, the next message is fetched or the
+// reader is closed, so each reader should be consumed from a single goroutine. Messages
+// returned by ReadMessage are committed as they are read and are not tracked.
 type DeviceChainKafkaReader struct {
-	kafka.Reader
+	*kafka.Reader
+
+	manager  *KafkaManager
+	mutex    sync.Mutex
+	working  func()
+	stopping chan struct{}
+	stopped  sync.Once
+}
+
+// Read the next message. While the kafka manager is paused, no new messages are fetched
+// until it is resumed (a read already waiting on the broker is not interrupted). Once the
+// microservice is draining for shutdown, no new messages are fetched.
+func (dckr *DeviceChainKafkaReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	err := dckr.await(ctx)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	return dckr.Reader.ReadMessage(ctx)
+}
+
+// Fetch the next message without committing it. Blocks while the kafka manager is paused
+// or the microservice is draining. The message is in-flight work until it is committed.
+func (dckr *DeviceChainKafkaReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	err := dckr.await(ctx)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	msg, err := dckr.Reader.FetchMessage(ctx)
+	if err == nil {
+		dckr.begin()
+	}
+	return msg, err
+}
+
+// Commit messages, completing in-flight work for the last message fetched.
+func (dckr *DeviceChainKafkaReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	err := dckr.Reader.CommitMessages(ctx, msgs...)
+	dckr.complete()
+	return err
+}
+
+// Close the reader, completing any in-flight work.
+func (dckr *DeviceChainKafkaReader) Close() error {
+	dckr.stop()
+	dckr.complete()
+	return dckr.Reader.Close()
+}
+
+// Complete the previous message, then wait until new messages may be fetched.
+func (dckr *DeviceChainKafkaReader) await(ctx context.Context) error {
+	dckr.complete()
+	err := dckr.manager.lifecycle.AwaitResume(ctx)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-dckr.stopping:
+		return io.EOF
+	default:
+	}
+	if dckr.manager.Microservice.Draining() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-dckr.stopping:
+			return io.EOF
+		}
+	}
+	return nil
+}
+
+// Track a fetched message as in-flight work.
+func (dckr *DeviceChainKafkaReader) begin() {
+	dckr.mutex.Lock()
+	defer dckr.mutex.Unlock()
+	if dckr.working != nil {
+		dckr.working()
+	}
+	dckr.working = dckr.manager.Microservice.BeginWork()
+}
+
+// Complete in-flight work for the last message fetched (if any).
+func (dckr *DeviceChainKafkaReader) complete() {
+	dckr.mutex.Lock()
+	defer dckr.mutex.Unlock()
+	if dckr.working != nil {
+		dckr.working()
+		dckr.working = nil
+	}
+}
+
+// Indicates whether a message fetched from the reader is still being processed.
+func (dckr *DeviceChainKafkaReader) busy() bool {
+	dckr.mutex.Lock()
+	defer dckr.mutex.Unlock()
+	return dckr.working != nil
+}
+
+// Stop fetching new messages.
+func (dckr *DeviceChainKafkaReader) stop() {
+	dckr.stopped.Do(func() {
+		close(dckr.stopping)
+	})
 }
 
 // Handle response from read operation.
@@ -144,7 +267,9 @@ func (kmgr *KafkaManager) NewReader(groupId string, topic string) (KafkaReader,
 		MaxBytes: 10e6,
 	})
 	reader := &DeviceChainKafkaReader{
-		Reader: *kreader,
+		Reader:   kreader,
+		manager:  kmgr,
+		stopping: make(chan struct{}),
 	}
 
 	log.Info().Msg(fmt.Sprintf("Added new kafka reader on group '%s' for topic '%s'", groupId, topic))
@@ -154,7 +279,7 @@ func (kmgr *KafkaManager) NewReader(groupId string, topic string) (KafkaReader,
 
 // Wraps kafka writer to add new functionality.
 type DeviceChainKafkaWriter struct {
-	kafka.Writer
+	*kafka.Writer
 }
 
 // Handle response from read operation.
@@ -166,13 +291,23 @@ func (dckr *DeviceChainKafkaWriter) HandleResponse(err error) {
 	}
 }
 
-// Create a new kafka writer.
+// Create a new kafka writer. Writers are closed when the kafka manager is stopped.
 func (kmgr *KafkaManager) NewWriter(topic string) (KafkaWriter, error) {
+	writer, err := kmgr.newWriter(topic)
+	if err != nil {
+		return nil, err
+	}
+	kmgr.writers = append(kmgr.writers, writer)
+	return writer, nil
+}
+
+// Create a kafka writer that is not closed with the kafka manager.
+func (kmgr *KafkaManager) newWriter(topic string) (*DeviceChainKafkaWriter, error) {
 	err := kmgr.ValidateTopic(topic)
 	if err != nil {
 		return nil, err
 	}
-	kwriter := kafka.Writer{
+	kwriter := &kafka.Writer{
 		Addr:         kafka.TCP(kmgr.KafkaBrokersUrl()),
 		Topic:        topic,
 		Balancer:     &kafka.LeastBytes{},
@@ -185,19 +320,23 @@ func (kmgr *KafkaManager) NewWriter(topic string) (KafkaWriter, error) {
 	}
 
 	log.Info().Msg(fmt.Sprintf("Added new kafka writer for topic '%s'", topic))
-	kmgr.writers = append(kmgr.writers, writer)
 	return writer, nil
 }
 
+// Get lifecycle manager for component.
+func (kmgr *KafkaManager) Lifecycle() *core.LifecycleManager {
+	return kmgr.lifecycle
+}
+
 // Initialize component.
 func (kmgr *KafkaManager) Initialize(ctx context.Context) error {
 	return kmgr.lifecycle.Initialize(ctx)
 }
 
 // Lifecycle callback that runs initialization logic.
-func (kmgr *KafkaManager) ExecuteInitialize(context.Context) error {
+func (kmgr *KafkaManager) ExecuteInitialize(ctx context.Context) error {
 	url := kmgr.KafkaBrokersUrl()
-	conn, err := kafka.Dial("tcp", url)
+	conn, err := kafka.DialContext(ctx, "tcp", url)
 	if err != nil {
 		return err
 	}
@@ -217,6 +356,15 @@ func (kmgr *KafkaManager) ExecuteStart(context.Context) error {
 	if err != nil {
 		return err
 	}
+
+	// Create writer for lifecycle events (kept open until the microservice is terminated).
+	if !kmgr.events.attached() {
+		writer, err := kmgr.newWriter(kmgr.NewScopedTopic(LIFECYCLE_EVENTS_TOPIC))
+		if err != nil {
+			return err
+		}
+		kmgr.events.attach(writer)
+	}
 	log.Info().Msg("Kafka component creation completed successfully.")
 	return nil
 }
@@ -226,8 +374,10 @@ func (kmgr *KafkaManager) Stop(ctx context.Context) error {
 	return kmgr.lifecycle.Stop(ctx)
 }
 
-// Lifecycle callback that runs shutdown logic.
-func (kmgr *KafkaManager) ExecuteStop(context.Context) error {
+// Lifecycle callback that runs shutdown logic. Readers stop fetching new messages and
+// messages already being processed are allowed to complete before readers are closed.
+func (kmgr *KafkaManager) ExecuteStop(ctx context.Context) error {
+	kmgr.awaitReaders(ctx)
 	log.Info().Msg("Shutting down kafka writers.")
 	for _, writer := range kmgr.writers {
 		if dckw, ok := writer.(*DeviceChainKafkaWriter); ok {
@@ -246,9 +396,36 @@ func (kmgr *KafkaManager) ExecuteStop(context.Context) error {
 			}
 		}
 	}
+
+	// Readers and writers are created again when restarted.
+	kmgr.readers = make([]KafkaReader, 0)
+	kmgr.writers = make([]KafkaWriter, 0)
 	return nil
 }
 
+// Stop readers from fetching new messages and wait for in-flight messages to complete.
+func (kmgr *KafkaManager) awaitReaders(ctx context.Context) {
+	readers := make([]*DeviceChainKafkaReader, 0)
+	for _, reader := range kmgr.readers {
+		if dckr, ok := reader.(*DeviceChainKafkaReader); ok {
+			dckr.stop()
+			readers = append(readers, dckr)
+		}
+	}
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for _, dckr := range readers {
+		for dckr.busy() {
+			select {
+			case <-ctx.Done():
+				log.Warn().Str("topic", dckr.Config().Topic).Msg("Closing kafka reader with message still in flight.")
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
 // Terminate component.
 func (kmgr *KafkaManager) Terminate(ctx context.Context) error {
 	return kmgr.lifecycle.Terminate(ctx)
@@ -18,6 +18,7 @@ package main
 
 import (
 	"context"
+	"os"
 
 	"github.com/devicechain-io/dc-microservice/core"
 	"github.com/rs/zerolog/log"
@@ -68,5 +69,6 @@ func main() {
 		},
 	}
 	ms := core.NewMicroservice(callbacks)
-	ms.Run()
+	err := ms.Run()
+	os.Exit(core.ExitCode(err))
 }
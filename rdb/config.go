@@ -22,13 +22,7 @@ import (
 	"github.com/devicechain-io/dc-microservice/config"
 )
 
-type PostgresConfig struct {
-	Hostname       string `json:"hostname"`
-	MaxConnections int32  `json:"maxConnections"`
-	Password       string `json:"password"`
-	Port           int32  `json:"port"`
-	Username       string `json:"username"`
-}
+type PostgresConfig = config.PostgresConfiguration
 
 // Use json marshaling to convert between generic config and strongly-typed.
 func convertToPostgresConfig(rdb config.DatastoreConfiguration) (*PostgresConfig, error) {
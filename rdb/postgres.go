@@ -19,6 +19,8 @@ package rdb
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	pgx "github.com/jackc/pgx/v4"
@@ -29,20 +31,20 @@ import (
 )
 
 // Compute non-database connection URL for querying/creating database.
-func (rdb *RdbManager) computePostgresRootUrl(pgconfig *PostgresConfig) string {
-	config := rdb.InstanceConfig
-	hostname := fmt.Sprintf("%v", config.Configuration["hostname"])
-	port := fmt.Sprintf("%v", config.Configuration["port"])
-	username := fmt.Sprintf("%v", config.Configuration["username"])
-	password := fmt.Sprintf("%v", config.Configuration["password"])
-	return fmt.Sprintf("postgres://%s:%s@%s:%s/postgres", username, password, hostname, port)
+func (rdb *RdbManager) computePostgresRootUrl(pgconfig *PostgresConfig) *url.URL {
+	return &url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(pgconfig.Username, pgconfig.Password),
+		Host:   fmt.Sprintf("%s:%d", pgconfig.Hostname, pgconfig.Port),
+		Path:   "/postgres",
+	}
 }
 
 // Assure that database is created before connecting to it.
-func (rdb *RdbManager) assurePostgresDatabase(pgconfig *PostgresConfig) error {
+func (rdb *RdbManager) assurePostgresDatabase(ctx context.Context, pgconfig *PostgresConfig) error {
 	url := rdb.computePostgresRootUrl(pgconfig)
-	log.Info().Str("database", rdb.Microservice.TenantId).Str("url", url).Msg("Verifying that tenant database exists.")
-	conn, err := pgx.Connect(context.Background(), url)
+	log.Info().Str("database", rdb.Microservice.TenantId).Str("url", url.Redacted()).Msg("Verifying that tenant database exists.")
+	conn, err := pgx.Connect(ctx, url.String())
 	if err != nil {
 		return err
 	}
@@ -50,7 +52,7 @@ func (rdb *RdbManager) assurePostgresDatabase(pgconfig *PostgresConfig) error {
 
 	// List all databases
 	found := false
-	result := conn.PgConn().ExecParams(context.Background(), "SELECT datname FROM pg_database WHERE datistemplate = false", [][]byte{}, nil, nil, nil)
+	result := conn.PgConn().ExecParams(ctx, "SELECT datname FROM pg_database WHERE datistemplate = false", [][]byte{}, nil, nil, nil)
 	for result.NextRow() {
 		currdb := string(result.Values()[0])
 		if rdb.Microservice.TenantId == currdb {
@@ -66,7 +68,7 @@ func (rdb *RdbManager) assurePostgresDatabase(pgconfig *PostgresConfig) error {
 	if !found {
 		// Create tenant database.
 		log.Info().Msg("Database was not found. Creating...")
-		result := conn.PgConn().ExecParams(context.Background(), fmt.Sprintf("CREATE DATABASE %s", rdb.Microservice.TenantId),
+		result := conn.PgConn().ExecParams(ctx, fmt.Sprintf("CREATE DATABASE %s", rdb.Microservice.TenantId),
 			[][]byte{}, nil, nil, nil)
 		_, err := result.Close()
 		if err != nil {
@@ -78,16 +80,21 @@ func (rdb *RdbManager) assurePostgresDatabase(pgconfig *PostgresConfig) error {
 	return nil
 }
 
-// Compute non-database connection URL for querying/creating database.
-func (rdb *RdbManager) computePostgresTenantDatabaseUrl(pg *PostgresConfig) string {
-	return fmt.Sprintf("postgres://%s:%s@%s:%d/%s", pg.Username, pg.Password, pg.Hostname, pg.Port, rdb.Microservice.TenantId)
+// Compute tenant database connection URL for querying/creating schema.
+func (rdb *RdbManager) computePostgresTenantDatabaseUrl(pgconfig *PostgresConfig) *url.URL {
+	return &url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(pgconfig.Username, pgconfig.Password),
+		Host:   fmt.Sprintf("%s:%d", pgconfig.Hostname, pgconfig.Port),
+		Path:   "/" + rdb.Microservice.TenantId,
+	}
 }
 
 // Assure that functional area schema is created before connecting to it.
-func (rdb *RdbManager) assurePostgresSchema(pgconfig *PostgresConfig) error {
+func (rdb *RdbManager) assurePostgresSchema(ctx context.Context, pgconfig *PostgresConfig) error {
 	log.Info().Str("schema", rdb.Microservice.FunctionalArea).Msg("Verifying that schema exists.")
 	url := rdb.computePostgresTenantDatabaseUrl(pgconfig)
-	conn, err := pgx.Connect(context.Background(), url)
+	conn, err := pgx.Connect(ctx, url.String())
 	if err != nil {
 		return err
 	}
@@ -95,7 +102,7 @@ func (rdb *RdbManager) assurePostgresSchema(pgconfig *PostgresConfig) error {
 
 	// List all databases
 	found := false
-	result := conn.PgConn().ExecParams(context.Background(), "SELECT schema_name FROM information_schema.schemata", [][]byte{}, nil, nil, nil)
+	result := conn.PgConn().ExecParams(ctx, "SELECT schema_name FROM information_schema.schemata", [][]byte{}, nil, nil, nil)
 	for result.NextRow() {
 		currsch := string(result.Values()[0])
 		if rdb.Microservice.FunctionalArea == currsch {
@@ -111,7 +118,7 @@ func (rdb *RdbManager) assurePostgresSchema(pgconfig *PostgresConfig) error {
 	if !found {
 		// Create functional area schema.
 		log.Info().Msg("Schema was not found. Creating...")
-		result := conn.PgConn().ExecParams(context.Background(), fmt.Sprintf("CREATE SCHEMA \"%s\"", rdb.Microservice.FunctionalArea),
+		result := conn.PgConn().ExecParams(ctx, fmt.Sprintf("CREATE SCHEMA \"%s\"", rdb.Microservice.FunctionalArea),
 			[][]byte{}, nil, nil, nil)
 		_, err := result.Close()
 		if err != nil {
@@ -126,22 +133,31 @@ func (rdb *RdbManager) assurePostgresSchema(pgconfig *PostgresConfig) error {
 // Compute DSN for connecting to database.
 func (rdb *RdbManager) computePostgresDsn(pg *PostgresConfig) string {
 	dsn := fmt.Sprintf("user=%s password=%s host=%s dbname=%s port=%d sslmode=disable",
-		pg.Username, pg.Password, pg.Hostname, rdb.Microservice.TenantId, pg.Port)
-	log.Info().Str("username", pg.Username).Str("password", pg.Password).Str("hostname", pg.Hostname).
+		quoteDsnValue(pg.Username), quoteDsnValue(pg.Password), quoteDsnValue(pg.Hostname),
+		quoteDsnValue(rdb.Microservice.TenantId), pg.Port)
+	log.Info().Str("username", pg.Username).Str("hostname", pg.Hostname).
 		Int32("port", pg.Port).Msg("Initializing database connectivity")
 	return dsn
 }
 
+// Quote a value for a key/value DSN so that spaces, quotes and backslashes (or an empty
+// value) do not change how the DSN is parsed.
+func quoteDsnValue(value string) string {
+	escaped := strings.ReplaceAll(value, `\`, `\\`)
+	escaped = strings.ReplaceAll(escaped, `'`, `\'`)
+	return "'" + escaped + "'"
+}
+
 // Boostrap a postgres database/schema.
-func (rdb *RdbManager) bootstrapPostgres(pgconf *PostgresConfig) error {
+func (rdb *RdbManager) bootstrapPostgres(ctx context.Context, pgconf *PostgresConfig) error {
 	// Verify/create tenant database.
-	err := rdb.assurePostgresDatabase(pgconf)
+	err := rdb.assurePostgresDatabase(ctx, pgconf)
 	if err != nil {
 		return err
 	}
 
 	// Verify/create functional area schema.
-	err = rdb.assurePostgresSchema(pgconf)
+	err = rdb.assurePostgresSchema(ctx, pgconf)
 	if err != nil {
 		return err
 	}
@@ -150,14 +166,14 @@ func (rdb *RdbManager) bootstrapPostgres(pgconf *PostgresConfig) error {
 }
 
 // Initialize a postgres database.
-func (rdb *RdbManager) initializePostgres() error {
+func (rdb *RdbManager) initializePostgres(ctx context.Context) error {
 	pgconf, err := convertToPostgresConfig(rdb.InstanceConfig)
 	if err != nil {
 		return err
 	}
 
 	// Bootstrap the postgres database/schema if needed.
-	err = rdb.bootstrapPostgres(pgconf)
+	err = rdb.bootstrapPostgres(ctx, pgconf)
 	if err != nil {
 		return err
 	}
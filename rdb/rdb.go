@@ -18,13 +18,16 @@ package rdb
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/devicechain-io/dc-microservice/config"
 	"github.com/devicechain-io/dc-microservice/core"
 	gormigrate "github.com/go-gormigrate/gormigrate/v2"
+	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 )
 
@@ -37,7 +40,7 @@ type RdbManager struct {
 	InstanceConfig     config.DatastoreConfiguration
 	MicroserviceConfig config.MicroserviceDatastoreConfiguration
 
-	lifecycle core.LifecycleManager
+	lifecycle *core.LifecycleManager
 }
 
 // Create a new rdb manager.
@@ -54,9 +57,22 @@ func NewRdbManager(ms *core.Microservice, callbacks core.LifecycleCallbacks,
 	// Create lifecycle manager.
 	rdbname := fmt.Sprintf("%s-%s", ms.FunctionalArea, "rdb")
 	rdb.lifecycle = core.NewLifecycleManager(rdbname, rdb, callbacks)
+	ms.AddHealthCheck(rdbname, rdb.CheckHealth)
 	return rdb
 }
 
+// Verify that the database responds to a ping.
+func (rdb *RdbManager) CheckHealth(ctx context.Context) error {
+	if rdb.Database == nil {
+		return errors.New("database is not initialized")
+	}
+	sqldb, err := rdb.Database.DB()
+	if err != nil {
+		return err
+	}
+	return sqldb.PingContext(ctx)
+}
+
 // Query for a list of models based on filter and pagination criteria.
 func (rdb *RdbManager) ListOf(mdl interface{}, filters func(db *gorm.DB) *gorm.DB, pag Pagination) (*gorm.DB, SearchResultsPagination) {
 	// Sanity check page number.
@@ -104,7 +120,7 @@ func (rdb *RdbManager) ListOf(mdl interface{}, filters func(db *gorm.DB) *gorm.D
 
 // Create a new redis cache with the given settings.
 func (rdb *RdbManager) NewRedisCache(name string, size int, ttl time.Duration) *core.RedisCache {
-	created := core.NewRedisCache(*rdb.Microservice.Redis, name, size, ttl)
+	created := core.NewRedisCache(rdb.Microservice.Redis, name, size, ttl)
 	rdb.RedisCaches[name] = created
 	return created
 }
@@ -114,22 +130,46 @@ func (rdb *RdbManager) GetRedisCache(name string) *core.RedisCache {
 	return rdb.RedisCaches[name]
 }
 
+// Get current statistics for all redis caches, ordered by cache name.
+func (rdb *RdbManager) RedisCacheStats() []core.CacheStats {
+	stats := make([]core.CacheStats, 0, len(rdb.RedisCaches))
+	for _, cache := range rdb.RedisCaches {
+		stats = append(stats, cache.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// Log current statistics for all redis caches.
+func (rdb *RdbManager) LogRedisCacheStats() {
+	for _, stats := range rdb.RedisCacheStats() {
+		log.Info().Str("cache", stats.Name).Uint64("hits", stats.Hits).Uint64("localHits", stats.LocalHits).
+			Uint64("misses", stats.Misses).Uint64("errors", stats.Errors).Uint64("loads", stats.Loads).
+			Dur("averageLoad", stats.AverageLoad).Float64("hitRatio", stats.HitRatio).Msg("Redis cache statistics.")
+	}
+}
+
+// Get lifecycle manager for component.
+func (rdb *RdbManager) Lifecycle() *core.LifecycleManager {
+	return rdb.lifecycle
+}
+
 // Initialize component.
 func (rdb *RdbManager) Initialize(ctx context.Context) error {
 	return rdb.lifecycle.Initialize(ctx)
 }
 
 // Lifecycle callback that runs initialization logic.
-func (rdb *RdbManager) ExecuteInitialize(context.Context) error {
+func (rdb *RdbManager) ExecuteInitialize(ctx context.Context) error {
 	// Make sure database exists before interacting with it.
 	dbtype := rdb.InstanceConfig.Type
 	if strings.HasPrefix(dbtype, "postgres") {
-		err := rdb.initializePostgres()
+		err := rdb.initializePostgres(ctx)
 		if err != nil {
 			return err
 		}
 	} else if strings.HasPrefix(dbtype, "timescaledb") {
-		err := rdb.initializePostgres()
+		err := rdb.initializePostgres(ctx)
 		if err != nil {
 			return err
 		}
@@ -148,6 +188,7 @@ func (rdb *RdbManager) ExecuteInitialize(context.Context) error {
 	}
 	m := gormigrate.New(rdb.Database, options, rdb.Migrations)
 	if err := m.Migrate(); err != nil {
+		rdb.closeDatabase()
 		return err
 	}
 
@@ -181,10 +222,18 @@ func (rdb *RdbManager) Terminate(ctx context.Context) error {
 
 // Lifecycle callback that runs termination logic.
 func (rdb *RdbManager) ExecuteTerminate(context.Context) error {
+	return rdb.closeDatabase()
+}
+
+// Close the connection pool for the database if one is open.
+func (rdb *RdbManager) closeDatabase() error {
+	if rdb.Database == nil {
+		return nil
+	}
 	sqldb, err := rdb.Database.DB()
 	if err != nil {
 		return err
 	}
-	sqldb.Close()
-	return nil
+	rdb.Database = nil
+	return sqldb.Close()
 }